@@ -12,11 +12,17 @@ import (
 	"github.com/gwangyi/webcfg/web"
 )
 
+type PoolConfig struct {
+	MaxConns int `web:"max_conns,Max Connections,number,layer-group,,," `
+	MinConns int `web:"min_conns,Min Connections,number,layer-group,,," `
+}
+
 type DatabaseConfig struct {
-	Host     string `web:"host,Host Name,text,server,,"`
-	Port     int    `web:"port,Port Number,number,hashtag,,,," `
-	User     string `web:"user,Username,text,user,," `
-	Password string `web:"password,Password,password,key,," `
+	Host     string     `web:"host,Host Name,text,server,,"`
+	Port     int        `web:"port,Port Number,number,hashtag,,,," `
+	User     string     `web:"user,Username,text,user,," `
+	Password string     `web:"password,Password,secret,key,," `
+	Pool     PoolConfig `web:"pool,Connection Pool,,,,," `
 }
 
 type FeatureConfig struct {
@@ -28,6 +34,18 @@ type AdvancedConfig struct {
 	MaxRetries uint          `web:"retries,Maximum Retries,number,redo,,," `
 	Threshold  float64       `web:"threshold,Success Threshold,number,chart-line,,," `
 	Duration   DurationValue `web:"duration,Refresh Interval,text,clock,,," `
+	LogLevel   LogLevel      `web:"log_level,Log Level,select,list,,," `
+}
+
+type LogLevel string
+
+func (LogLevel) Options(parent any) []web.Choice {
+	return []web.Choice{
+		{Value: "debug", Label: "Debug"},
+		{Value: "info", Label: "Info"},
+		{Value: "warn", Label: "Warning"},
+		{Value: "error", Label: "Error"},
+	}
 }
 
 type DurationValue time.Duration
@@ -97,6 +115,10 @@ func main() {
 			Host: "localhost",
 			Port: 5432,
 			User: "admin",
+			Pool: PoolConfig{
+				MaxConns: 10,
+				MinConns: 2,
+			},
 		},
 		Features: FeatureConfig{
 			EnableFeatureA: true,
@@ -105,6 +127,7 @@ func main() {
 			MaxRetries: 3,
 			Threshold:  0.95,
 			Duration:   DurationValue(5 * time.Minute),
+			LogLevel:   "info",
 		},
 		Theme: web.Theme{
 			Primary: "#8e44ad", // Wisteria purple
@@ -112,7 +135,14 @@ func main() {
 	}
 	cfg.Description.About = "This is a simple application to demonstrate webcfg functionality.\nIt supports various field types including text, number, checkbox, and now textarea!\nTry changing some values and clicking 'Submit'."
 
-	handler, err := web.New(cfg, web.WithAssets(os.DirFS(assetsDir)), web.WithTheme(&cfg.Theme))
+	// Log what changed rather than the whole config, since the audit log
+	// redacts secrets such as the database password.
+	logChange := func(c web.Change) {
+		for _, f := range c.Fields {
+			log.Printf("%s.%s: %q -> %q", c.Section, f.Field, f.Old, f.New)
+		}
+	}
+	handler, err := web.New(cfg, web.WithAssets(os.DirFS(assetsDir)), web.WithTheme(&cfg.Theme), web.WithAudit(logChange))
 	if err != nil {
 		log.Fatalf("Failed to create handler: %v", err)
 	}
@@ -121,9 +151,6 @@ func main() {
 	wrappedHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodPost {
 			log.Printf("Update request for %s", r.URL.Path)
-			defer func() {
-				log.Printf("Current Config: %+v", cfg)
-			}()
 		}
 		handler.ServeHTTP(w, r)
 	})
@@ -2,4 +2,9 @@ module github.com/gwangyi/webcfg
 
 go 1.25.5
 
-require github.com/crazy3lf/colorconv v1.2.0 // indirect
+require (
+	github.com/crazy3lf/colorconv v1.2.0
+	github.com/pelletier/go-toml/v2 v2.4.3
+	golang.org/x/crypto v0.50.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,106 @@
+package web
+
+import (
+	"slices"
+	"strings"
+)
+
+// WithRoles grants roles to authenticated principals. roles maps principal
+// names to the roles they are granted, in addition to any set by their
+// authenticator.
+func WithRoles(roles map[string][]string) Option {
+	return func(o *configPageOptions) {
+		if o.roles == nil {
+			o.roles = map[string][]string{}
+		}
+		for name, granted := range roles {
+			o.roles[name] = append(o.roles[name], granted...)
+		}
+	}
+}
+
+// HasRole reports whether the principal has role. A nil principal has no
+// roles.
+func (p *Principal) HasRole(role string) bool {
+	return p != nil && slices.Contains(p.Roles, role)
+}
+
+// hasAnyRole reports whether the principal has one of roles, or roles is
+// empty.
+func (p *Principal) hasAnyRole(roles []string) bool {
+	if len(roles) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(roles, p.HasRole)
+}
+
+// parseAccess parses an access tag such as "view=ops admin,edit=admin" into
+// the roles required to view and to edit a node.
+func parseAccess(tag string) (view, edit []string) {
+	for part := range strings.SplitSeq(tag, ",") {
+		key, roles, _ := strings.Cut(part, "=")
+		switch strings.TrimSpace(key) {
+		case "view":
+			view = append(view, strings.Fields(roles)...)
+		case "edit":
+			edit = append(edit, strings.Fields(roles)...)
+		}
+	}
+	return view, edit
+}
+
+// access is what a principal may do with a node.
+type access int
+
+const (
+	editAccess access = iota
+	viewAccess
+	noAccess
+)
+
+// accessOf returns what principal may do with n itself, regardless of the
+// nodes it is nested in.
+func (n *Node) accessOf(principal *Principal) access {
+	switch {
+	case !principal.hasAnyRole(n.View):
+		return noAccess
+	case !principal.hasAnyRole(n.Edit):
+		return viewAccess
+	}
+	return editAccess
+}
+
+// restrict returns the part of n that principal may view, with the nodes it
+// may not edit marked read-only, or nil if it may not view n at all.
+// readonly tells whether a node n is nested in is read-only. Unrestricted
+// nodes are returned as is.
+func (n *Node) restrict(principal *Principal, readonly bool) *Node {
+	if !n.restricted && !readonly {
+		return n
+	}
+	level := n.accessOf(principal)
+	if level == noAccess {
+		return nil
+	}
+	c := *n
+	c.readonly = readonly || level == viewAccess
+	c.Fields = nil
+	for _, f := range n.Fields {
+		if f = f.restrict(principal, c.readonly); f != nil {
+			c.Fields = append(c.Fields, f)
+		}
+	}
+	return &c
+}
+
+// publicSections returns the parts of sections that principals without roles
+// may view.
+func publicSections(sections []*Node) []*Node {
+	var public []*Node
+	for _, section := range sections {
+		if section = section.restrict(nil, false); section != nil {
+			public = append(public, section)
+		}
+	}
+	return public
+}
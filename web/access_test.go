@@ -0,0 +1,199 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gwangyi/webcfg/web"
+)
+
+type AccessBackend struct {
+	Host string `web:"host"`
+}
+
+type AccessServer struct {
+	Host     string          `web:"host"`
+	Port     int             `web:"port" access:"edit=admin"`
+	Password string          `web:"password" access:"view=admin"`
+	Backends []AccessBackend `web:"backends" access:"edit=admin"`
+}
+
+type AccessTheme struct {
+	Primary string `web:"primary"`
+}
+
+type AccessConfig struct {
+	Server AccessServer
+	Theme  AccessTheme `access:"edit=admin"`
+	Audit  struct {
+		Level string `web:"level"`
+	} `access:"view=admin"`
+}
+
+// accessHandler returns a handler of cfg letting the principal "ops" view
+// and "admin" edit everything, and a function authenticating requests to it
+// as either.
+func accessHandler(t *testing.T, cfg *AccessConfig) func(name string) http.Handler {
+	handler, err := web.New(cfg,
+		web.WithAuth(web.BearerTokens(map[string]string{"ops": "olivia", "admin": "adam"})),
+		web.WithRoles(map[string][]string{"adam": {"admin"}}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+name)
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+func newAccessConfig() *AccessConfig {
+	cfg := &AccessConfig{}
+	cfg.Server = AccessServer{Host: "db", Port: 5432, Password: "hunter2", Backends: []AccessBackend{{Host: "a"}}}
+	cfg.Theme.Primary = "#00d1b2"
+	cfg.Audit.Level = "debug"
+	return cfg
+}
+
+func TestAccessPage(t *testing.T) {
+	as := accessHandler(t, newAccessConfig())
+
+	body := (&client{}).get(as("ops"))
+	for _, unwanted := range []string{"hunter2", `name="password"`, `action="/Audit"`, `name="backends"`, `class="button is-small webcfg-add"`} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("expected page of ops not to contain %s", unwanted)
+		}
+	}
+	for _, wanted := range []string{`value="5432" readonly`, `value="a" readonly`, `value="#00d1b2" readonly`} {
+		if !strings.Contains(body, wanted) {
+			t.Errorf("expected page of ops to contain %s", wanted)
+		}
+	}
+	if n := strings.Count(body, `type="submit"`); n != 1 {
+		t.Errorf("expected only Server to be submittable by ops, got %d forms", n)
+	}
+
+	body = (&client{}).get(as("admin"))
+	for _, wanted := range []string{"hunter2", `action="/Audit"`, `name="backends"`} {
+		if !strings.Contains(body, wanted) {
+			t.Errorf("expected page of admin to contain %s", wanted)
+		}
+	}
+	if strings.Contains(body, "readonly") {
+		t.Errorf("expected nothing to be read-only for admin")
+	}
+}
+
+func TestAccessUpdate(t *testing.T) {
+	cfg := newAccessConfig()
+	as := accessHandler(t, cfg)
+	ops := &client{}
+
+	// The page posts read-only fields unchanged.
+	ops.post(as("ops"), "/Server", url.Values{"host": {"db2"}, "port": {"5432"}, "backends.0.host": {"a"}})
+	if cfg.Server.Host != "db2" || cfg.Server.Port != 5432 || cfg.Server.Password != "hunter2" || len(cfg.Server.Backends) != 1 {
+		t.Fatalf("unexpected config %+v", cfg.Server)
+	}
+
+	for _, form := range []url.Values{
+		{"host": {"db3"}, "port": {"1"}},
+		{"host": {"db3"}, "password": {"guess"}},
+		{"host": {"db3"}, "password": {"hunter2"}},
+		{"host": {"db3"}, "backends": {"0", "1"}, "backends.0.host": {"a"}, "backends.1.host": {"b"}},
+	} {
+		ops.post(as("ops"), "/Server", form)
+		if cfg.Server.Host != "db2" || cfg.Server.Port != 5432 || cfg.Server.Password != "hunter2" || len(cfg.Server.Backends) != 1 {
+			t.Errorf("expected %v to be rejected, got %+v", form, cfg.Server)
+		}
+		if body := ops.get(as("ops")); !strings.Contains(body, "Update failed") {
+			t.Errorf("expected %v to fail", form)
+		}
+	}
+
+	ops.post(as("ops"), "/Theme", url.Values{"primary": {"#ff0000"}})
+	if cfg.Theme.Primary != "#00d1b2" {
+		t.Errorf("expected the theme to be read-only for ops, got %q", cfg.Theme.Primary)
+	}
+
+	admin := &client{}
+	admin.post(as("admin"), "/Server", url.Values{"host": {"db"}, "port": {"1"}, "password": {"s3cret"}})
+	if cfg.Server.Port != 1 || cfg.Server.Password != "s3cret" || len(cfg.Server.Backends) != 0 {
+		t.Errorf("unexpected config %+v", cfg.Server)
+	}
+}
+
+func TestAccessAPI(t *testing.T) {
+	cfg := newAccessConfig()
+	as := accessHandler(t, cfg)
+
+	rr := apiRequest(as("ops"), http.MethodGet, "/api/config", "")
+	if body := rr.Body.String(); strings.Contains(body, "hunter2") || strings.Contains(body, "Audit") || !strings.Contains(body, `"port": 5432`) {
+		t.Errorf("unexpected config for ops %s", body)
+	}
+	rr = apiRequest(as("ops"), http.MethodGet, "/api/sections/Audit", "")
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", rr.Code)
+	}
+
+	rr = apiRequest(as("ops"), http.MethodGet, "/api/sections/Server", "")
+	if body := rr.Body.String(); rr.Code != http.StatusOK || strings.Contains(body, "password") {
+		t.Fatalf("unexpected response %d %s", rr.Code, body)
+	}
+	// A section read by ops can be written back with changes to the fields
+	// ops may edit.
+	put := strings.Replace(rr.Body.String(), `"db"`, `"db2"`, 1)
+	if rr := apiRequest(as("ops"), http.MethodPut, "/api/sections/Server", put); rr.Code != http.StatusOK {
+		t.Errorf("unexpected response %d %s", rr.Code, rr.Body.String())
+	}
+	if cfg.Server.Host != "db2" || cfg.Server.Password != "hunter2" {
+		t.Errorf("unexpected config %+v", cfg.Server)
+	}
+
+	for _, tc := range []struct{ path, body string }{
+		{"/api/sections/Server", `{"password": "guess"}`},
+		{"/api/sections/Server", `{"port": 1}`},
+		{"/api/sections/Theme", `{"primary": "#ff0000"}`},
+	} {
+		rr := apiRequest(as("ops"), http.MethodPatch, tc.path, tc.body)
+		if body := decodeAPIError(t, rr); rr.Code != http.StatusForbidden || body.Error == "" {
+			t.Errorf("expected %s to be forbidden, got %d %s", tc.body, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := apiRequest(as("admin"), http.MethodPatch, "/api/sections/Server", `{"port": 1}`); rr.Code != http.StatusOK || cfg.Server.Port != 1 {
+		t.Errorf("unexpected response %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAccessDocuments(t *testing.T) {
+	handler, err := web.New(newAccessConfig(),
+		web.WithAuth(web.BearerTokens(map[string]string{"ops": "olivia", "admin": "adam"})),
+		web.WithRoles(map[string][]string{"adam": {"admin"}}),
+		web.WithSchema(),
+		web.WithOpenAPI(),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, path := range []string{"/api/schema", "/api/openapi.json"} {
+		for _, token := range []string{"ops", "admin"} {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			body := rr.Body.String()
+			if rr.Code != http.StatusOK || !strings.Contains(body, `"Server"`) {
+				t.Fatalf("%s as %s: unexpected response %d %s", path, token, rr.Code, body)
+			}
+			for _, hidden := range []string{`"Audit"`, `"password"`, "debug"} {
+				if strings.Contains(body, hidden) {
+					t.Errorf("%s as %s: expected %s to be left out", path, token, hidden)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxAPIBody limits the size of request bodies accepted by the JSON API.
+const maxAPIBody = 1 << 20
+
+type apiFieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type apiError struct {
+	Error  string          `json:"error"`
+	Errors []apiFieldError `json:"errors,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	body := apiError{Error: err.Error()}
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		for _, fe := range verr.Errors {
+			body.Errors = append(body.Errors, apiFieldError{Field: fe.Field, Code: fe.Code, Message: fe.Message})
+		}
+	}
+	writeJSON(w, status, body)
+}
+
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	writeAPIError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
+
+// serveAPI serves the JSON API under /api/. Sections use the same keys as
+// the file stores.
+func (p *Handler[T]) serveAPI(w http.ResponseWriter, r *http.Request) {
+	if p.csrf && !isSafeMethod(r.Method) && !sameOrigin(r) {
+		writeAPIError(w, http.StatusForbidden, errors.New("cross-origin request"))
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/api")
+	switch {
+	case path == "/config":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, "GET")
+			return
+		}
+		principal := principalFrom(r.Context())
+		p.mu.RLock()
+		v := reflect.ValueOf(p.config).Elem()
+		tree := object{}
+		for _, section := range schemaOf(reflect.TypeFor[T]()).Sections {
+			if section = section.restrict(principal, false); section != nil {
+				obj := redactSecrets(encodeStruct(section.value(v), section.Fields), section.Fields, hideSecret)
+				tree = append(tree, member{section.Name, obj})
+			}
+		}
+		p.mu.RUnlock()
+		writeJSON(w, http.StatusOK, tree)
+	case path == "/openapi.json" && p.openapi != nil:
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, "GET")
+			return
+		}
+		p.serveOpenAPI(w, r)
+	case path == "/schema" && p.schema != nil:
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, "GET")
+			return
+		}
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(p.schema)
+	case strings.HasPrefix(path, "/sections/"):
+		p.serveAPISection(w, r, strings.TrimPrefix(path, "/sections/"))
+	default:
+		writeAPIError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// sameOrigin reports whether r names the host it was sent to in its Origin
+// header or, failing that, its Referer header. Browsers send one of them
+// with cross-origin requests, so requests with neither come from other
+// clients and are allowed.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && u.Host == r.Host
+}
+
+func (p *Handler[T]) serveAPISection(w http.ResponseWriter, r *http.Request, name string) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPatch:
+		if status, err := p.updateSectionJSON(r, name); err != nil {
+			writeAPIError(w, status, err)
+			return
+		}
+	default:
+		methodNotAllowed(w, "GET, PUT, PATCH")
+		return
+	}
+
+	section := schemaOf(reflect.TypeFor[T]()).Section(name)
+	if section == nil {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("%w: %s", ErrSectionNotFound, name))
+		return
+	}
+	if section = section.restrict(principalFrom(r.Context()), false); section == nil {
+		writeAPIError(w, http.StatusForbidden, fmt.Errorf("%w: %s", ErrForbidden, name))
+		return
+	}
+	p.mu.RLock()
+	tree := encodeStruct(section.value(reflect.ValueOf(p.config).Elem()), section.Fields)
+	p.mu.RUnlock()
+	tree = redactSecrets(tree, section.Fields, hideSecret)
+	writeJSON(w, http.StatusOK, tree)
+}
+
+// updateSectionJSON applies the JSON object in the body of r to the named
+// section. PUT sets every field like a form submission, while PATCH only
+// sets the fields present in the body. It returns the status code to
+// respond with on failure.
+func (p *Handler[T]) updateSectionJSON(r *http.Request, name string) (int, error) {
+	section := schemaOf(reflect.TypeFor[T]()).Section(name)
+	if section == nil {
+		return http.StatusNotFound, fmt.Errorf("%w: %s", ErrSectionNotFound, name)
+	}
+
+	var body any
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxAPIBody))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return http.StatusBadRequest, errors.New("invalid JSON: unexpected data after the object")
+	}
+
+	e := &formEncoder{form: url.Values{}}
+	if r.Method == http.MethodPatch {
+		e.partial = map[string]bool{}
+	}
+	e.encodeStruct(section.Fields, body, "", name+".")
+	if len(e.errs.Errors) > 0 {
+		return http.StatusUnprocessableEntity, &e.errs
+	}
+
+	// Hook notifications are not tied to a browser session, so they are
+	// shown to everyone.
+	change := Change{Principal: principalFrom(r.Context()), Source: "api"}
+	if _, err := p.updateSection(name, e.form, e.partial, change, p); err != nil {
+		var verr *ValidationError
+		if errors.Is(err, ErrForbidden) {
+			return http.StatusForbidden, err
+		}
+		if errors.As(err, &verr) {
+			return http.StatusUnprocessableEntity, err
+		}
+		if errors.Is(err, ErrSave) {
+			return http.StatusInternalServerError, err
+		}
+		// The UpdateReceiver of the section rejected the update.
+		return http.StatusConflict, err
+	}
+	return 0, nil
+}
+
+// isSettable reports whether the form decoder can set the field n. Slices
+// of scalars are only set as the choices of multiselect fields.
+func isSettable(n *Node) bool {
+	return n.Kind != FieldNode || isScalarType(n.Type) || n.HasOptions() && n.Type.Kind() == reflect.Slice
+}
+
+// hideSecret omits secrets from what is read through the API, whatever
+// their type. Since fields missing from an update keep their secrets, a
+// section read from the API can be written back unchanged.
+func hideSecret(any) (any, bool) {
+	return nil, false
+}
+
+// formEncoder flattens a JSON section into the values the HTML form would
+// post for it, so that API updates are decoded like form submissions.
+type formEncoder struct {
+	form url.Values
+	// partial, if not nil, collects the names of the fields that are set.
+	partial map[string]bool
+	errs    ValidationError
+}
+
+func (e *formEncoder) fail(path string, err *ParseError) {
+	err.Field = path
+	e.errs.add(&FieldError{Field: path, Code: "parse", Message: fmt.Sprintf("%s: %v", err.Message, err.Err), Err: err})
+}
+
+func (e *formEncoder) mismatch(path string, node any) {
+	e.fail(path, &ParseError{Message: "invalid value", Err: fmt.Errorf("unexpected %T", node)})
+}
+
+func (e *formEncoder) set(name string, values ...string) {
+	e.form[name] = values
+	if e.partial != nil {
+		e.partial[name] = true
+	}
+}
+
+// encodeStruct flattens node into the fields of a struct. name and path are
+// the prefixes of the form names and paths of the fields.
+func (e *formEncoder) encodeStruct(fields []*Node, node any, name, path string) {
+	obj, ok := members(node)
+	if !ok {
+		e.mismatch(strings.TrimSuffix(path, "."), node)
+		return
+	}
+
+	for _, m := range obj {
+		i := slices.IndexFunc(fields, func(n *Node) bool { return n.Name == m.Key })
+		if i < 0 {
+			e.errs.add(&FieldError{Field: path + m.Key, Code: "unknown", Message: "unknown field"})
+			continue
+		}
+		n := fields[i]
+		fieldName := name + m.Key
+		fieldPath := path + m.Key
+
+		switch {
+		case n.Kind == StructNode:
+			e.encodeStruct(n.Fields, m.Value, fieldName+".", fieldPath+".")
+		case n.Kind == ListNode:
+			items, ok := m.Value.([]any)
+			if !ok {
+				e.mismatch(fieldPath, m.Value)
+				continue
+			}
+			keys := make([]string, len(items))
+			for j, item := range items {
+				keys[j] = strconv.Itoa(j)
+				e.encodeStruct(n.Fields, item, fieldName+"."+keys[j]+".", fieldPath+"."+keys[j]+".")
+			}
+			e.set(fieldName, keys...)
+		case n.Kind == MapNode:
+			rows, ok := members(m.Value)
+			if !ok {
+				e.mismatch(fieldPath, m.Value)
+				continue
+			}
+			keys := make([]string, len(rows))
+			for j, row := range rows {
+				keys[j] = strconv.Itoa(j)
+				text, ok := scalarText(row.Value)
+				if !ok {
+					e.mismatch(fieldPath+"."+row.Key, row.Value)
+					continue
+				}
+				e.form.Set(fieldName+"."+keys[j]+".key", row.Key)
+				e.form.Set(fieldName+"."+keys[j]+".value", text)
+			}
+			e.set(fieldName, keys...)
+		case !isSettable(n):
+			e.errs.add(&FieldError{Field: fieldPath, Code: "unsupported", Message: "cannot be set through the API"})
+		case n.Type.Kind() == reflect.Slice && isScalarType(n.Type.Elem()):
+			items, ok := m.Value.([]any)
+			if !ok {
+				e.mismatch(fieldPath, m.Value)
+				continue
+			}
+			values := make([]string, len(items))
+			for j, item := range items {
+				if values[j], ok = scalarText(item); !ok {
+					e.mismatch(fieldPath+"."+strconv.Itoa(j), item)
+				}
+			}
+			e.set(fieldName, values...)
+		case n.IsSecret() && m.Value == nil:
+			// null clears a secret, since an empty string keeps it.
+			e.set(fieldName, "")
+			e.form.Add(clearField, fieldName)
+		default:
+			text, ok := scalarText(m.Value)
+			if _, isBool := m.Value.(bool); !ok || n.Type.Kind() == reflect.Bool && !isBool {
+				e.mismatch(fieldPath, m.Value)
+				continue
+			}
+			e.set(fieldName, text)
+		}
+	}
+}
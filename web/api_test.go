@@ -0,0 +1,292 @@
+package web_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gwangyi/webcfg/web"
+)
+
+func apiRequest(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+type apiErrorBody struct {
+	Error  string
+	Errors []struct {
+		Field   string
+		Code    string
+		Message string
+	}
+}
+
+func decodeAPIError(t *testing.T, rr *httptest.ResponseRecorder) apiErrorBody {
+	t.Helper()
+	var body apiErrorBody
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid error body %q: %v", rr.Body.String(), err)
+	}
+	return body
+}
+
+func TestAPIGet(t *testing.T) {
+	cfg := &ListConfig{}
+	cfg.Proxy.Name = "proxy"
+	cfg.Proxy.Upstreams = []Upstream{{Host: "a", Weight: 1}}
+	handler, _ := web.New(cfg)
+
+	rr := apiRequest(handler, http.MethodGet, "/api/config", "")
+	want := `{"Proxy":{"Name":"proxy","upstreams":[{"host":"a","weight":1,"Rules":[]}]}}`
+	var compact bytes.Buffer
+	json.Compact(&compact, rr.Body.Bytes())
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" || compact.String() != want {
+		t.Errorf("unexpected response %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = apiRequest(handler, http.MethodGet, "/api/sections/Proxy", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"Name": "proxy"`) {
+		t.Errorf("unexpected response %d %s", rr.Code, rr.Body.String())
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodGet, "/api/sections/Missing", http.StatusNotFound},
+		{http.MethodPut, "/api/sections/Missing", http.StatusNotFound},
+		{http.MethodGet, "/api/unknown", http.StatusNotFound},
+		{http.MethodPost, "/api/config", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/api/sections/Proxy", http.StatusMethodNotAllowed},
+	} {
+		rr := apiRequest(handler, tc.method, tc.path, "{}")
+		if rr.Code != tc.status || decodeAPIError(t, rr).Error == "" {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.path, tc.status, rr.Code)
+		}
+	}
+}
+
+func TestAPIPut(t *testing.T) {
+	cfg := &ListConfig{}
+	cfg.Proxy.Name = "old"
+	handler, _ := web.New(cfg)
+
+	rr := apiRequest(handler, http.MethodPut, "/api/sections/Proxy", `{"upstreams": [{"host": "a", "weight": 2}, {"host": "b"}]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %s", rr.Code, rr.Body.String())
+	}
+	handler.Read(func(cfg *ListConfig) {
+		if cfg.Proxy.Name != "" || len(cfg.Proxy.Upstreams) != 2 || cfg.Proxy.Upstreams[0].Weight != 2 || cfg.Proxy.Upstreams[1].Host != "b" {
+			t.Errorf("unexpected config %+v", cfg.Proxy)
+		}
+		if cfg.Proxy.updates != 1 {
+			t.Errorf("expected Updated to be called once, got %d", cfg.Proxy.updates)
+		}
+	})
+	if !strings.Contains(rr.Body.String(), `"host": "b"`) {
+		t.Errorf("expected updated section in response, got %s", rr.Body.String())
+	}
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		for _, body := range []string{`{`, `{"Name": "x"}garbage`, `{"Name": "x"} {"Name": "y"}`} {
+			rr := apiRequest(handler, http.MethodPut, "/api/sections/Proxy", body)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected 400, got %d", body, rr.Code)
+			}
+		}
+		if handler.Snapshot().Proxy.Name != "" {
+			t.Errorf("expected config to be untouched")
+		}
+	})
+
+	t.Run("Field errors", func(t *testing.T) {
+		rr := apiRequest(handler, http.MethodPut, "/api/sections/Proxy", `{"upstreams": [{"weight": "heavy"}], "bogus": 1, "Name": {}}`)
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("expected 422, got %d", rr.Code)
+		}
+		body := decodeAPIError(t, rr)
+		codes := map[string]string{}
+		for _, e := range body.Errors {
+			codes[e.Field] = e.Code
+		}
+		if codes["Proxy.bogus"] != "unknown" || codes["Proxy.Name"] != "parse" {
+			t.Errorf("unexpected errors %+v", body.Errors)
+		}
+		if handler.Snapshot().Proxy.Upstreams[0].Weight != 2 {
+			t.Errorf("expected config to be untouched")
+		}
+
+		rr = apiRequest(handler, http.MethodPut, "/api/sections/Proxy", `{"upstreams": [{"weight": "heavy"}]}`)
+		body = decodeAPIError(t, rr)
+		if rr.Code != http.StatusUnprocessableEntity || len(body.Errors) != 1 || body.Errors[0].Field != "Proxy.upstreams.0.weight" || body.Errors[0].Code != "parse" {
+			t.Errorf("unexpected response %d %+v", rr.Code, body)
+		}
+	})
+}
+
+func TestAPIPatch(t *testing.T) {
+	cfg := &NestedConfig{}
+	cfg.Database.Host = "db"
+	cfg.Database.Pool = PoolConfig{MaxConns: 10, MinConns: 2}
+	cfg.Database.TLS.Enabled = true
+	handler, _ := web.New(cfg)
+
+	rr := apiRequest(handler, http.MethodPatch, "/api/sections/Database", `{"Pool": {"MaxConns": 3}}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %s", rr.Code, rr.Body.String())
+	}
+	got := handler.Snapshot().Database
+	if got.Host != "db" || got.Pool.MaxConns != 3 || got.Pool.MinConns != 2 || !got.TLS.Enabled {
+		t.Errorf("expected omitted fields to be kept, got %+v", got)
+	}
+
+	rr = apiRequest(handler, http.MethodPatch, "/api/sections/Database", `{"TLS": {"Enabled": false}}`)
+	if rr.Code != http.StatusOK || handler.Snapshot().Database.TLS.Enabled {
+		t.Errorf("expected TLS to be disabled")
+	}
+}
+
+func TestAPIPatchList(t *testing.T) {
+	cfg := &ListConfig{}
+	cfg.Proxy.Name = "proxy"
+	cfg.Proxy.Upstreams = []Upstream{{Host: "a", Weight: 1}, {Host: "b", Weight: 2}}
+	handler, _ := web.New(cfg)
+
+	// Lists are replaced as a whole.
+	rr := apiRequest(handler, http.MethodPatch, "/api/sections/Proxy", `{"upstreams": [{"host": "c"}]}`)
+	got := handler.Snapshot().Proxy
+	if rr.Code != http.StatusOK || got.Name != "proxy" || len(got.Upstreams) != 1 || got.Upstreams[0].Host != "c" || got.Upstreams[0].Weight != 0 {
+		t.Errorf("unexpected response %d %+v", rr.Code, got)
+	}
+}
+
+func TestAPIUnsupportedField(t *testing.T) {
+	cfg := &StoredConfig{}
+	cfg.Server.Regions = []string{"eu"}
+	handler, _ := web.New(cfg)
+
+	rr := apiRequest(handler, http.MethodPatch, "/api/sections/Server", `{"name": "new", "regions": ["us"]}`)
+	body := decodeAPIError(t, rr)
+	if rr.Code != http.StatusUnprocessableEntity || len(body.Errors) != 1 || body.Errors[0].Field != "Server.regions" || body.Errors[0].Code != "unsupported" {
+		t.Errorf("unexpected response %d %+v", rr.Code, body)
+	}
+	if cfg.Server.Name != "" || cfg.Server.Regions[0] != "eu" {
+		t.Errorf("expected config to be untouched, got %+v", cfg.Server)
+	}
+}
+
+func TestAPIChoices(t *testing.T) {
+	handler, _ := web.New(&ChoiceConfig{})
+	rr := apiRequest(handler, http.MethodPatch, "/api/sections/Section", `{"level": "verbose"}`)
+	body := decodeAPIError(t, rr)
+	if rr.Code != http.StatusUnprocessableEntity || len(body.Errors) != 1 || body.Errors[0].Field != "Section.level" {
+		t.Errorf("unexpected response %d %+v", rr.Code, body)
+	}
+
+	rr = apiRequest(handler, http.MethodPatch, "/api/sections/Section", `{"level": "info", "regions": ["eu", "us"]}`)
+	got := handler.Snapshot().Section
+	if rr.Code != http.StatusOK || got.Level != "info" || len(got.Regions) != 2 {
+		t.Errorf("unexpected response %d %+v", rr.Code, got)
+	}
+}
+
+func TestAPICrossOrigin(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		method  string
+		header  string
+		value   string
+		want    int
+		options []web.Option
+	}{
+		{"no origin", http.MethodPatch, "", "", http.StatusOK, nil},
+		{"same origin", http.MethodPatch, "Origin", "http://example.com", http.StatusOK, nil},
+		{"cross origin", http.MethodPatch, "Origin", "https://evil.example", http.StatusForbidden, nil},
+		{"null origin", http.MethodPut, "Origin", "null", http.StatusForbidden, nil},
+		{"same referer", http.MethodPatch, "Referer", "http://example.com/", http.StatusOK, nil},
+		{"cross referer", http.MethodPatch, "Referer", "https://evil.example/page", http.StatusForbidden, nil},
+		{"cross origin read", http.MethodGet, "Origin", "https://evil.example", http.StatusOK, nil},
+		{"without CSRF", http.MethodPatch, "Origin", "https://evil.example", http.StatusOK, []web.Option{web.WithoutCSRF()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			handler, _ := web.New(&NestedConfig{}, tc.options...)
+			req := httptest.NewRequest(tc.method, "/api/sections/Database", strings.NewReader(`{"Host": "db"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.want {
+				t.Fatalf("expected %d, got %d %s", tc.want, rr.Code, rr.Body.String())
+			}
+			if changed := handler.Snapshot().Database.Host == "db"; changed != (tc.want == http.StatusOK && tc.method != http.MethodGet) {
+				t.Errorf("unexpected host %q", handler.Snapshot().Database.Host)
+			}
+		})
+	}
+}
+
+func TestAPIBoolean(t *testing.T) {
+	cfg := &NestedConfig{}
+	cfg.Database.TLS.Enabled = true
+	handler, _ := web.New(cfg)
+
+	for _, value := range []string{`"banana"`, `1`, `"true"`} {
+		rr := apiRequest(handler, http.MethodPatch, "/api/sections/Database", `{"TLS": {"Enabled": `+value+`}}`)
+		body := decodeAPIError(t, rr)
+		if rr.Code != http.StatusUnprocessableEntity || len(body.Errors) != 1 || body.Errors[0].Field != "Database.TLS.Enabled" || body.Errors[0].Code != "parse" {
+			t.Errorf("%s: unexpected response %d %+v", value, rr.Code, body)
+		}
+	}
+	if !handler.Snapshot().Database.TLS.Enabled {
+		t.Errorf("expected config to be untouched")
+	}
+}
+
+func TestAPIOverriddenField(t *testing.T) {
+	t.Setenv("APP_DATABASE_HOST", "db")
+	handler, _ := web.New(&EnvConfig{}, web.WithEnv("APP"))
+
+	for _, method := range []string{http.MethodPatch, http.MethodPut} {
+		rr := apiRequest(handler, method, "/api/sections/Database", `{"host": "other", "Ignored": "x"}`)
+		body := decodeAPIError(t, rr)
+		if rr.Code != http.StatusUnprocessableEntity || len(body.Errors) != 1 || body.Errors[0].Code != "overridden" || !strings.Contains(body.Errors[0].Message, "$APP_DATABASE_HOST") {
+			t.Errorf("%s: unexpected response %d %+v", method, rr.Code, body)
+		}
+	}
+	if got := handler.Snapshot().Database; got.Host != "db" || got.Ignored != "" {
+		t.Errorf("expected config to be untouched, got %+v", got)
+	}
+
+	// A section read from the API can be written back unchanged.
+	rr := apiRequest(handler, http.MethodPut, "/api/sections/Database", `{"host": "db", "Ignored": "x"}`)
+	if rr.Code != http.StatusOK || handler.Snapshot().Database.Ignored != "x" {
+		t.Errorf("unexpected response %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAPIUpdateErrors(t *testing.T) {
+	calls := []int{}
+	store := &countingStore{}
+	handler, _ := web.New(&HookedConfig{Section: HookedSection{calls: &calls}}, web.WithStore[HookedConfig](store))
+
+	rr := apiRequest(handler, http.MethodPatch, "/api/sections/Section", `{"value": -1}`)
+	if rr.Code != http.StatusConflict || !strings.Contains(decodeAPIError(t, rr).Error, "negative value") {
+		t.Errorf("expected rejected update to return 409, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	store.saveErr = errors.New("disk full")
+	rr = apiRequest(handler, http.MethodPatch, "/api/sections/Section", `{"value": 1}`)
+	if rr.Code != http.StatusInternalServerError || !strings.Contains(decodeAPIError(t, rr).Error, "disk full") {
+		t.Errorf("expected failed save to return 500, got %d %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,119 @@
+package web
+
+import (
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Change records an update of a section.
+type Change struct {
+	Time    time.Time
+	Section string
+	// Principal made the change, or is nil if the change was not made by
+	// an authenticated request.
+	Principal *Principal
+	// Source is how the change was made: "form", "api" or "reload".
+	Source string
+	Fields []FieldChange
+}
+
+// FieldChange is a value of a section that changed. Fields of lists and
+// maps are identified by their index or key, such as backends.0.host or
+// labels.env. Values missing before or after the change are empty, and
+// secrets that are set are [redacted].
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// WithAudit calls record with every change made to the config through the
+// page, the JSON API or a reload of the store. It is called with the write
+// lock held, and must not call Read, Snapshot or Update.
+func WithAudit(record func(Change)) Option {
+	return func(o *configPageOptions) {
+		o.audit = record
+	}
+}
+
+// record passes the change of section from old to the current value to the
+// audit function, if any. change holds who made it and how.
+func (p *Handler[T]) record(change Change, section *Node, old reflect.Value) {
+	if p.audit == nil {
+		return
+	}
+	v := reflect.ValueOf(p.config).Elem()
+	change.Time = time.Now()
+	change.Section = section.Name
+	change.Fields = diffSection(section, old, section.value(v))
+	if len(change.Fields) > 0 {
+		p.audit(change)
+	}
+}
+
+// diffSection returns the values that differ between the sections old and
+// new, in the order of the fields.
+func diffSection(section *Node, old, new reflect.Value) []FieldChange {
+	var before, after object
+	flatten(&before, "", redactedStruct(old, section.Fields))
+	flatten(&after, "", redactedStruct(new, section.Fields))
+
+	var changes []FieldChange
+	for _, m := range after {
+		prev, _ := lookup(before, m.Key)
+		if prev != m.Value {
+			changes = append(changes, FieldChange{Field: m.Key, Old: text(prev), New: text(m.Value)})
+		}
+	}
+	for _, m := range before {
+		if _, ok := lookup(after, m.Key); !ok {
+			changes = append(changes, FieldChange{Field: m.Key, Old: text(m.Value)})
+		}
+	}
+	return changes
+}
+
+// flatten appends the scalars of the tree node to out, keyed by their
+// dotted path under prefix.
+func flatten(out *object, prefix string, node any) {
+	switch n := node.(type) {
+	case object:
+		for _, m := range n {
+			flatten(out, prefix+m.Key+".", m.Value)
+		}
+	case mapping:
+		flatten(out, prefix, object(n))
+	case []any:
+		for i, item := range n {
+			flatten(out, prefix+strconv.Itoa(i)+".", item)
+		}
+	default:
+		*out = append(*out, member{prefix[:len(prefix)-1], n})
+	}
+}
+
+// redactedStruct encodes the struct v with its secrets wrapped in secret.
+func redactedStruct(v reflect.Value, fields []*Node) object {
+	return redactSecrets(encodeStruct(v, fields), fields, func(value any) (any, bool) { return secret{value}, true })
+}
+
+// secret is the value of a secret field in a tree. It compares like the
+// value, but its text only tells whether it is set.
+type secret struct {
+	value any
+}
+
+// redacted is the text of secrets that are set.
+const redacted = "[redacted]"
+
+func text(node any) string {
+	if s, ok := node.(secret); ok {
+		if reflect.ValueOf(s.value).IsZero() {
+			return ""
+		}
+		return redacted
+	}
+	s, _ := scalarText(node)
+	return s
+}
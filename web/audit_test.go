@@ -0,0 +1,73 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gwangyi/webcfg/web"
+)
+
+func TestWithAudit(t *testing.T) {
+	var changes []web.Change
+	cfg := &StoredConfig{}
+	cfg.Server.Name = "old"
+	cfg.Server.Labels = map[string]string{"env": "dev", "team": "core"}
+	handler, _ := web.New(cfg,
+		web.WithAuth(web.BearerTokens(map[string]string{"token-bob": "bob"})),
+		web.WithAudit(func(c web.Change) { changes = append(changes, c) }),
+	)
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/sections/Server", strings.NewReader(`{"name": "new", "labels": {"env": "prod"}, "backends": [{"host": "a"}]}`))
+	req.Header.Set("Authorization", "Bearer token-bob")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %s", rr.Code, rr.Body.String())
+	}
+
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change, got %v", changes)
+	}
+	c := changes[0]
+	if c.Section != "Server" || c.Source != "api" || c.Principal == nil || c.Principal.Name != "bob" || c.Time.IsZero() {
+		t.Errorf("unexpected change %+v", c)
+	}
+	want := []web.FieldChange{
+		{Field: "name", Old: "old", New: "new"},
+		{Field: "labels.env", Old: "dev", New: "prod"},
+		{Field: "backends.0.host", Old: "", New: "a"},
+		{Field: "labels.team", Old: "core", New: ""},
+	}
+	if !reflect.DeepEqual(c.Fields, want) {
+		t.Errorf("expected %v, got %v", want, c.Fields)
+	}
+
+	t.Run("Unchanged", func(t *testing.T) {
+		changes = nil
+		req := httptest.NewRequest(http.MethodPatch, "/api/sections/Server", strings.NewReader(`{"name": "new"}`))
+		req.Header.Set("Authorization", "Bearer token-bob")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if len(changes) != 0 {
+			t.Errorf("expected no change to be recorded, got %v", changes)
+		}
+	})
+}
+
+func TestWithAuditForm(t *testing.T) {
+	var changes []web.Change
+	cfg := &StoredConfig{}
+	handler, _ := web.New(cfg, web.WithAudit(func(c web.Change) { changes = append(changes, c) }))
+
+	c := &client{}
+	c.post(handler, "/Other", url.Values{"value": {"42"}})
+	if len(changes) != 1 || changes[0].Source != "form" || changes[0].Principal != nil {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	if want := []web.FieldChange{{Field: "value", Old: "0", New: "42"}}; !reflect.DeepEqual(changes[0].Fields, want) {
+		t.Errorf("expected %v, got %v", want, changes[0].Fields)
+	}
+}
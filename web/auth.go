@@ -0,0 +1,259 @@
+package web
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Principal is the user a request was authenticated as.
+type Principal struct {
+	Name string
+	// Roles grant access to the sections and fields restricted by access
+	// tags.
+	Roles []string
+}
+
+// Authenticator authenticates requests for WithAuth.
+type Authenticator interface {
+	// Authenticate returns the principal r was sent by, or nil if r has no
+	// valid credentials for the authenticator.
+	Authenticate(r *http.Request) *Principal
+}
+
+// challenger is an Authenticator asking clients for credentials in the
+// WWW-Authenticate header of 401 responses.
+type challenger interface {
+	challenge() string
+}
+
+// checker is an Authenticator whose configuration New checks.
+type checker interface {
+	check() error
+}
+
+// WithAuth requires every request to be authenticated by one of auths,
+// which are tried in order. Other requests are answered with 401
+// Unauthorized.
+func WithAuth(auths ...Authenticator) Option {
+	return func(o *configPageOptions) {
+		o.auth = append(o.auth, auths...)
+	}
+}
+
+type principalKey struct{}
+
+// principalFrom returns the principal of the request with context ctx, or nil
+// if the handler has no authenticators.
+func principalFrom(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// authenticate returns r with its principal in its context, or false if no
+// authenticator accepts it.
+func (p *Handler[T]) authenticate(r *http.Request) (*http.Request, bool) {
+	if len(p.auth) == 0 {
+		return r, true
+	}
+	for _, auth := range p.auth {
+		if principal := auth.Authenticate(r); principal != nil {
+			if roles := p.roles[principal.Name]; len(roles) > 0 {
+				// Copy the principal, which the authenticator may reuse.
+				granted := *principal
+				granted.Roles = append(slices.Clip(granted.Roles), roles...)
+				principal = &granted
+			}
+			return r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)), true
+		}
+	}
+	return r, false
+}
+
+func (p *Handler[T]) unauthorized(w http.ResponseWriter, r *http.Request) {
+	for _, auth := range p.auth {
+		if c, ok := auth.(challenger); ok {
+			w.Header().Add("WWW-Authenticate", c.challenge())
+		}
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		writeAPIError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
+
+// principalNotifier passes the principal making an update to UpdateReceiver
+// hooks along with the notifier of the request.
+type principalNotifier struct {
+	Notifier
+	principal *Principal
+}
+
+// PrincipalOf returns the principal making the update that n was passed to
+// an UpdateReceiver for, or nil if the update was not made by an
+// authenticated request, such as a reload of the store.
+func PrincipalOf(n Notifier) *Principal {
+	if pn, ok := n.(*principalNotifier); ok {
+		return pn.principal
+	}
+	return nil
+}
+
+type basicAuth struct {
+	realm string
+	users map[string][]byte
+
+	// verified caches the credentials that were verified recently, since
+	// bcrypt is slow by design and a page load makes several requests.
+	// They are keyed by their HMAC with key, so that passwords are not
+	// kept in memory.
+	mu       sync.Mutex
+	key      []byte
+	verified map[[sha256.Size]byte]time.Time
+}
+
+// basicAuthTTL is how long verified credentials are cached.
+const basicAuthTTL = 5 * time.Minute
+
+// dummyHash returns a hash compared against the passwords of unknown users,
+// so that they take as long to reject as wrong passwords.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("webcfg"), bcrypt.DefaultCost)
+	return hash
+})
+
+// BasicAuth authenticates requests with HTTP Basic authentication. users
+// maps user names to bcrypt hashes of their passwords, such as those
+// generated by htpasswd -B.
+func BasicAuth(realm string, users map[string]string) Authenticator {
+	a := &basicAuth{realm: realm, users: map[string][]byte{}, key: make([]byte, 32), verified: map[[sha256.Size]byte]time.Time{}}
+	rand.Read(a.key)
+	for name, hash := range users {
+		a.users[name] = []byte(hash)
+	}
+	return a
+}
+
+func (a *basicAuth) Authenticate(r *http.Request) *Principal {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return nil
+	}
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(name + ":" + password))
+	sum := [sha256.Size]byte(mac.Sum(nil))
+	now := time.Now()
+	a.mu.Lock()
+	expires, ok := a.verified[sum]
+	a.mu.Unlock()
+	if ok && now.Before(expires) {
+		return &Principal{Name: name}
+	}
+
+	hash, known := a.users[name]
+	if !known {
+		hash = dummyHash()
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || !known {
+		return nil
+	}
+	a.mu.Lock()
+	maps.DeleteFunc(a.verified, func(_ [sha256.Size]byte, expires time.Time) bool { return !now.Before(expires) })
+	a.verified[sum] = now.Add(basicAuthTTL)
+	a.mu.Unlock()
+	return &Principal{Name: name}
+}
+
+func (a *basicAuth) challenge() string {
+	return `Basic realm="` + strings.ReplaceAll(a.realm, `"`, `'`) + `", charset="UTF-8"`
+}
+
+type bearerTokens map[string]string
+
+// BearerTokens authenticates requests with an Authorization: Bearer header.
+// tokens maps tokens to the names of the principals they authenticate.
+func BearerTokens(tokens map[string]string) Authenticator {
+	return bearerTokens(tokens)
+}
+
+func (t bearerTokens) Authenticate(r *http.Request) *Principal {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil
+	}
+	// Compare with every token, so that the time taken does not tell how
+	// close token is to a valid one.
+	var principal *Principal
+	for valid, name := range t {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(valid)) == 1 {
+			principal = &Principal{Name: name}
+		}
+	}
+	return principal
+}
+
+func (bearerTokens) challenge() string {
+	return "Bearer"
+}
+
+type trustedHeader struct {
+	header  string
+	proxies []netip.Prefix
+}
+
+// TrustedHeader authenticates requests by the user name a reverse proxy
+// puts in header, such as X-Forwarded-User. The header is only trusted on
+// requests coming from the addresses of proxies, and New fails if none are
+// given, since clients could otherwise set the header themselves. The proxy
+// must also remove the header from the requests it forwards.
+func TrustedHeader(header string, proxies ...netip.Prefix) Authenticator {
+	return &trustedHeader{header: header, proxies: proxies}
+}
+
+func (a *trustedHeader) check() error {
+	if len(a.proxies) == 0 {
+		return fmt.Errorf("trusted header %s: no proxies given", a.header)
+	}
+	return nil
+}
+
+func (a *trustedHeader) Authenticate(r *http.Request) *Principal {
+	name := r.Header.Get(a.header)
+	if name == "" || !a.trusted(r.RemoteAddr) {
+		return nil
+	}
+	return &Principal{Name: name}
+}
+
+func (a *trustedHeader) trusted(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range a.proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/gwangyi/webcfg/web"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type AuthSection struct {
+	Host string `web:"host"`
+	by   string
+}
+
+func (s *AuthSection) Updated(parent any, n web.Notifier) error {
+	if p := web.PrincipalOf(n); p != nil {
+		s.by = p.Name
+	}
+	return nil
+}
+
+type AuthConfig struct {
+	Server AuthSection
+}
+
+func TestWithAuth(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	handler, err := web.New(&AuthConfig{}, web.WithAuth(
+		web.BasicAuth("Config", map[string]string{"alice": string(hash)}),
+		web.BearerTokens(map[string]string{"token-bob": "bob"}),
+		web.TrustedHeader("X-Forwarded-User", netip.MustParsePrefix("10.0.0.0/8")),
+	))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		path   string
+		header func(*http.Request)
+		want   int
+	}{
+		{"none", "/", func(*http.Request) {}, http.StatusUnauthorized},
+		{"basic", "/", func(r *http.Request) { r.SetBasicAuth("alice", "secret") }, http.StatusOK},
+		{"basic wrong password", "/", func(r *http.Request) { r.SetBasicAuth("alice", "wrong") }, http.StatusUnauthorized},
+		{"basic unknown user", "/", func(r *http.Request) { r.SetBasicAuth("mallory", "secret") }, http.StatusUnauthorized},
+		{"bearer", "/api/config", func(r *http.Request) { r.Header.Set("Authorization", "Bearer token-bob") }, http.StatusOK},
+		{"bearer wrong token", "/api/config", func(r *http.Request) { r.Header.Set("Authorization", "Bearer token-eve") }, http.StatusUnauthorized},
+		{"header from proxy", "/", func(r *http.Request) {
+			r.RemoteAddr = "10.1.2.3:4567"
+			r.Header.Set("X-Forwarded-User", "carol")
+		}, http.StatusOK},
+		{"header from client", "/", func(r *http.Request) { r.Header.Set("X-Forwarded-User", "carol") }, http.StatusUnauthorized},
+		{"header from outside the proxies", "/", func(r *http.Request) {
+			r.RemoteAddr = "11.0.0.1:4567"
+			r.Header.Set("X-Forwarded-User", "carol")
+		}, http.StatusUnauthorized},
+		{"assets", "/assets/css/bulma.min.css", func(*http.Request) {}, http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			tc.header(req)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tc.want {
+				t.Fatalf("expected %d, got %d", tc.want, rr.Code)
+			}
+			if tc.want == http.StatusUnauthorized {
+				if got := strings.Join(rr.Header().Values("WWW-Authenticate"), "; "); got != `Basic realm="Config", charset="UTF-8"; Bearer` {
+					t.Errorf("unexpected challenge %q", got)
+				}
+			}
+		})
+	}
+
+	t.Run("API error", func(t *testing.T) {
+		rr := apiRequest(handler, http.MethodGet, "/api/config", "")
+		if body := decodeAPIError(t, rr); rr.Code != http.StatusUnauthorized || body.Error != "unauthorized" {
+			t.Errorf("unexpected response %d %s", rr.Code, rr.Body.String())
+		}
+	})
+}
+
+func TestPrincipalOf(t *testing.T) {
+	cfg := &AuthConfig{}
+	handler, _ := web.New(cfg, web.WithAuth(web.BearerTokens(map[string]string{"token-bob": "bob"})))
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/sections/Server", strings.NewReader(`{"host": "db"}`))
+	req.Header.Set("Authorization", "Bearer token-bob")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %s", rr.Code, rr.Body.String())
+	}
+	if cfg.Server.by != "bob" {
+		t.Errorf("expected the hook to see bob, got %q", cfg.Server.by)
+	}
+}
+
+func TestTrustedHeaderRequiresProxies(t *testing.T) {
+	_, err := web.New(&AuthConfig{}, web.WithAuth(web.TrustedHeader("X-Forwarded-User")))
+	if err == nil || !strings.Contains(err.Error(), "X-Forwarded-User") {
+		t.Errorf("expected TrustedHeader without proxies to be rejected, got %v", err)
+	}
+}
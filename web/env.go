@@ -0,0 +1,52 @@
+package web
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// WithEnv overlays the config with environment variables when the handler
+// is created. Variable names are derived from the section and field names,
+// such as APP_DATABASE_MAX_CONNS for the field Database.MaxConns with the
+// prefix APP. An env tag sets the full name of the variable instead, and
+// env:"-" ignores the field. Only scalar fields outside lists are looked up.
+func WithEnv(prefix string) Option {
+	return func(o *configPageOptions) {
+		o.env = &prefix
+	}
+}
+
+// envOverlays returns an overlay for every field of the config v whose
+// environment variable is set.
+func envOverlays(v reflect.Value, prefix string) []overlay {
+	var overlays []overlay
+	for _, f := range overlayFields(v, prefix, "env", envName) {
+		if value, ok := os.LookupEnv(f.name); ok {
+			overlays = append(overlays, overlay{index: f.index, path: f.path, source: "$" + f.name, value: value})
+		}
+	}
+	return overlays
+}
+
+// envName joins prefix and name in upper snake case, splitting name at
+// case changes and non-alphanumeric characters.
+func envName(prefix, name string) string {
+	var b strings.Builder
+	if prefix != "" {
+		b.WriteString(prefix)
+		b.WriteByte('_')
+	}
+	runes := []rune(name)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			r = '_'
+		} else if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+			i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,84 @@
+package web_test
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gwangyi/webcfg/web"
+)
+
+type EnvSection struct {
+	Host     string `web:"host"`
+	MaxConns int
+	Debug    bool
+	Secret   string     `env:"CUSTOM_SECRET"`
+	Ignored  string     `env:"-"`
+	Pool     PoolConfig `web:"pool"`
+}
+
+type EnvConfig struct {
+	Database EnvSection
+}
+
+func TestWithEnv(t *testing.T) {
+	t.Setenv("APP_DATABASE_HOST", "db")
+	t.Setenv("APP_DATABASE_MAX_CONNS", "10")
+	t.Setenv("APP_DATABASE_DEBUG", "1")
+	t.Setenv("CUSTOM_SECRET", "secret")
+	t.Setenv("APP_DATABASE_IGNORED", "ignored")
+	t.Setenv("APP_DATABASE_POOL_MAX_CONNS", "5")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"Database": {"host": "file", "Ignored": "file"}}`), 0o644)
+	store := web.NewJSONFileStore[EnvConfig](path)
+
+	cfg := &EnvConfig{}
+	handler, err := web.New(cfg, web.WithStore[EnvConfig](store), web.WithEnv("APP"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := EnvSection{Host: "db", MaxConns: 10, Debug: true, Secret: "secret", Ignored: "file", Pool: PoolConfig{MaxConns: 5}}
+	if got := handler.Snapshot().Database; got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	c := &client{}
+	body := c.get(handler)
+	if !strings.Contains(body, `value="db" readonly`) || !strings.Contains(body, "$APP_DATABASE_HOST") {
+		t.Errorf("expected env field to be read-only with its source")
+	}
+	if !strings.Contains(body, "$APP_DATABASE_POOL_MAX_CONNS") {
+		t.Errorf("expected nested env field to show its source")
+	}
+
+	// Read-only inputs post the value of the variable.
+	c.post(handler, "/Database", url.Values{"host": {"db"}, "Ignored": {"posted"}})
+	got := handler.Snapshot().Database
+	if got.Host != "db" || got.Debug != true || got.Ignored != "posted" {
+		t.Errorf("expected env fields to be kept, got %+v", got)
+	}
+	c.post(handler, "/Database", url.Values{"host": {"posted"}})
+	if body := c.get(handler); !strings.Contains(body, "set by $APP_DATABASE_HOST") {
+		t.Errorf("expected changing an env field to fail")
+	}
+
+	var saved EnvConfig
+	if err := store.Load(&saved); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if saved.Database.Host != "file" || saved.Database.Ignored != "posted" || saved.Database.MaxConns != 0 {
+		t.Errorf("expected env values not to be saved, got %+v", saved.Database)
+	}
+}
+
+func TestWithEnvInvalid(t *testing.T) {
+	t.Setenv("APP_DATABASE_MAX_CONNS", "many")
+	t.Setenv("APP_DATABASE_DEBUG", "yes")
+	_, err := web.New(&EnvConfig{}, web.WithEnv("APP"))
+	if err == nil || !strings.Contains(err.Error(), "$APP_DATABASE_MAX_CONNS") || !strings.Contains(err.Error(), "$APP_DATABASE_DEBUG") {
+		t.Errorf("expected errors naming the variables, got %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package web
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// BindFlags registers a flag on fs for every scalar field outside lists of
+// config, with the current value as its default and the help or label from
+// the web tag as its usage. Flags are named after the section and field
+// names in lower kebab case, such as -database-max-conns, or by a flag tag;
+// flag:"-" skips the field.
+//
+// Pass fs to WithFlags after parsing it. Flags set on the command line then
+// take precedence over the environment, which takes precedence over the
+// store, which takes precedence over the values config was initialized with.
+func BindFlags[T any](fs *flag.FlagSet, config *T) {
+	v := reflect.ValueOf(config).Elem()
+	for _, f := range overlayFields(v, "", "flag", flagName) {
+		usage := f.node.Help
+		if usage == "" {
+			usage = f.node.Label
+		}
+		value := &fieldFlag{root: v.Type(), index: f.index, path: f.path}
+		// The value is shown as the default in the usage message.
+		if !f.node.IsSecret() {
+			value.value = formatValue(f.value)
+		}
+		fs.Var(value, f.name, usage)
+	}
+}
+
+// WithFlags overlays the config with the flags registered by BindFlags that
+// were set on fs.
+func WithFlags(fs *flag.FlagSet) Option {
+	return func(o *configPageOptions) {
+		o.flags = fs
+	}
+}
+
+// fieldFlag is the flag.Value of a config field. It keeps the text of the
+// flag, which is applied to the config as an overlay.
+type fieldFlag struct {
+	root  reflect.Type
+	index []int
+	path  string
+	value string
+}
+
+func (f *fieldFlag) String() string {
+	return f.value
+}
+
+func (f *fieldFlag) Set(s string) error {
+	if err := setText(reflect.New(f.root).Elem().FieldByIndex(f.index), s); err != nil {
+		return fmt.Errorf("%s: %w", err.Message, err.Err)
+	}
+	f.value = s
+	return nil
+}
+
+func (f *fieldFlag) IsBoolFlag() bool {
+	return f.root != nil && f.root.FieldByIndex(f.index).Type.Kind() == reflect.Bool
+}
+
+// flagOverlays returns an overlay for every flag of fs bound to a field of
+// the config v that was set.
+func flagOverlays(v reflect.Value, fs *flag.FlagSet) []overlay {
+	var overlays []overlay
+	fs.Visit(func(fl *flag.Flag) {
+		if f, ok := fl.Value.(*fieldFlag); ok && f.root == v.Type() {
+			overlays = append(overlays, overlay{index: f.index, path: f.path, source: "-" + fl.Name, value: f.value})
+		}
+	})
+	return overlays
+}
+
+func flagName(prefix, name string) string {
+	return strings.ToLower(strings.ReplaceAll(envName(prefix, name), "_", "-"))
+}
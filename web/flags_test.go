@@ -0,0 +1,64 @@
+package web_test
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/gwangyi/webcfg/web"
+)
+
+type FlagSection struct {
+	Host    string `web:"host,Host,,,,Database host name"`
+	Port    int    `flag:"port"`
+	Debug   bool
+	Custom  MyTextUnmarshaler
+	Ignored string     `flag:"-"`
+	Pool    PoolConfig `web:"pool"`
+}
+
+type FlagConfig struct {
+	Database FlagSection
+}
+
+func TestBindFlags(t *testing.T) {
+	cfg := &FlagConfig{Database: FlagSection{Host: "default", Port: 5432}}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	web.BindFlags(fs, cfg)
+
+	host := fs.Lookup("database-host")
+	if host == nil || host.Usage != "Database host name" || host.DefValue != "default" {
+		t.Fatalf("unexpected flag %+v", host)
+	}
+	if fs.Lookup("port") == nil || fs.Lookup("database-pool-max-conns") == nil || fs.Lookup("database-custom") == nil {
+		t.Errorf("expected port, pool and custom flags")
+	}
+	if fs.Lookup("database-ignored") != nil {
+		t.Errorf("expected ignored field to have no flag")
+	}
+
+	if err := fs.Parse([]string{"-port", "abc"}); err == nil {
+		t.Errorf("expected invalid flag value to be rejected")
+	}
+	if err := fs.Parse([]string{"-database-host", "flag", "-database-debug", "-database-pool-max-conns", "3"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Setenv("APP_DATABASE_HOST", "env")
+	t.Setenv("APP_DATABASE_PORT", "6543")
+	handler, err := web.New(cfg, web.WithEnv("APP"), web.WithFlags(fs))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := handler.Snapshot().Database
+	if got.Host != "flag" || got.Port != 6543 || !got.Debug || got.Pool.MaxConns != 3 {
+		t.Errorf("expected flags to take precedence over env, got %+v", got)
+	}
+
+	body := (&client{}).get(handler)
+	if !strings.Contains(body, "-database-host") || !strings.Contains(body, "$APP_DATABASE_PORT") {
+		t.Errorf("expected fields to show their source")
+	}
+}
@@ -6,7 +6,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 var MockFSError = errors.New("mock fs error")
@@ -17,13 +21,21 @@ func (m *MockFS) Open(name string) (fs.File, error) {
 	return nil, MockFSError
 }
 
-func TestWriteIndexParseError(t *testing.T) {
-	// Backup original FS
+// setIndexFS replaces the file system the page template is parsed from
+// until the end of the test.
+func setIndexFS(t *testing.T, fsys fs.FS) {
 	originalFS := indexTmplFS
-	defer func() { indexTmplFS = originalFS }()
+	t.Cleanup(func() {
+		indexTmplFS = originalFS
+		indexTemplate = sync.OnceValues(parseIndexTemplate)
+	})
+	indexTmplFS = fsys
+	indexTemplate = sync.OnceValues(parseIndexTemplate)
+}
 
+func TestWriteIndexParseError(t *testing.T) {
 	// Set bad FS
-	indexTmplFS = &MockFS{}
+	setIndexFS(t, &MockFS{})
 
 	p := &Page{}
 	// We can call unexported writeIndex since we are in package web
@@ -40,9 +52,7 @@ func TestWriteIndexParseError(t *testing.T) {
 }
 
 func TestServeHTTP_WriteError(t *testing.T) {
-	originalFS := indexTmplFS
-	defer func() { indexTmplFS = originalFS }()
-	indexTmplFS = &MockFS{}
+	setIndexFS(t, &MockFS{})
 
 	cfg := &struct{}{}
 	handler, _ := New(cfg)
@@ -55,3 +65,71 @@ func TestServeHTTP_WriteError(t *testing.T) {
 		t.Errorf("expected 500 Internal Server Error, got %d", rr.Code)
 	}
 }
+
+func TestSessionStorePrune(t *testing.T) {
+	s := newSessionStore()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	rr := httptest.NewRecorder()
+	s.start(rr, httptest.NewRequest(http.MethodGet, "/", nil), "/")
+
+	now = now.Add(sessionTTL + time.Minute)
+	s.start(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), "/")
+
+	if len(s.sessions) != 1 {
+		t.Errorf("expected expired session to be pruned, got %d sessions", len(s.sessions))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(rr.Result().Cookies()[0])
+	if id := s.lookup(req); id != "" {
+		t.Errorf("expected expired session not to be found")
+	}
+
+	for i := 0; i < maxSessions+1; i++ {
+		now = now.Add(time.Millisecond)
+		s.start(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), "/")
+	}
+	if len(s.sessions) != maxSessions {
+		t.Errorf("expected %d sessions, got %d", maxSessions, len(s.sessions))
+	}
+
+	for i := 0; i < maxBroadcasts+1; i++ {
+		s.broadcast(Notification{Message: "broadcast"})
+	}
+	if len(s.broadcasts) != maxBroadcasts {
+		t.Errorf("expected %d broadcasts, got %d", maxBroadcasts, len(s.broadcasts))
+	}
+}
+
+func TestBasicAuthCache(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	a := BasicAuth("Config", map[string]string{"alice": string(hash)}).(*basicAuth)
+	request := func(name, password string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.SetBasicAuth(name, password)
+		return r
+	}
+
+	if a.Authenticate(request("alice", "wrong")) != nil || len(a.verified) != 0 {
+		t.Fatalf("expected a wrong password to be rejected and not cached")
+	}
+	if a.Authenticate(request("alice", "secret")) == nil || len(a.verified) != 1 {
+		t.Fatalf("expected the password to be accepted and cached")
+	}
+	// Without the hash, only the cache can accept the password.
+	a.users["alice"] = nil
+	if p := a.Authenticate(request("alice", "secret")); p == nil || p.Name != "alice" {
+		t.Errorf("expected the cached password to be accepted")
+	}
+	if a.Authenticate(request("alice", "other")) != nil {
+		t.Errorf("expected other passwords to be rejected")
+	}
+	for sum := range a.verified {
+		a.verified[sum] = time.Now()
+	}
+	if a.Authenticate(request("alice", "secret")) != nil {
+		t.Errorf("expected an expired entry to be verified again")
+	}
+}
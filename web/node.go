@@ -0,0 +1,255 @@
+package web
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// Schema describes how the handler sees a config type: its sections and,
+// nested in them, the fields of every struct, list and map with the
+// metadata of their tags. Renderers, exporters and tests can walk it
+// instead of inspecting the type themselves.
+type Schema struct {
+	Type     reflect.Type
+	Sections []*Node
+
+	// err tells why New rejects the type, such as a list of structs that
+	// contain the list again, whose fields are left out, or a secret map.
+	err error
+}
+
+// NodeKind tells how a node is edited.
+type NodeKind int
+
+const (
+	// SectionNode is a struct field of the config, edited as a form.
+	SectionNode NodeKind = iota
+	// StructNode is a nested struct, edited as a subsection.
+	StructNode
+	// ListNode is a slice of structs, edited as rows.
+	ListNode
+	// MapNode is a map with scalar keys and values, edited as key/value
+	// rows.
+	MapNode
+	// FieldNode is any other field, edited as a single input.
+	FieldNode
+)
+
+func (k NodeKind) String() string {
+	switch k {
+	case SectionNode:
+		return "section"
+	case StructNode:
+		return "struct"
+	case ListNode:
+		return "list"
+	case MapNode:
+		return "map"
+	case FieldNode:
+		return "field"
+	}
+	return "unknown"
+}
+
+// Node is a section of a config or a field of a struct in it.
+type Node struct {
+	Kind NodeKind
+	// Name is the key of the node in forms, stores and error paths: the Go
+	// field name of sections and the name from the web tag of fields.
+	Name string
+	// Label, Input, Icon, Status and Help come from the web tag. Input is
+	// the type of the HTML input, such as text, checkbox or select.
+	Label  string
+	Input  string
+	Icon   string
+	Status string
+	Help   string
+	// Rules are the rules of the validate tag.
+	Rules []Rule
+	// View and Edit are the roles of the access tag. Principals need one
+	// of the View roles to see the node, and one of the Edit roles to
+	// change it. Nodes nested in a node take on its restrictions.
+	View []string
+	Edit []string
+	// Field is the struct field of the node, and Type its Go type.
+	Field reflect.StructField
+	Type  reflect.Type
+	// Fields are the fields of sections, nested structs and list rows.
+	Fields []*Node
+
+	// set parses the text of a field into its value.
+	set setter
+	// restricted tells whether the node or a node nested in it has an
+	// access tag.
+	restricted bool
+	// readonly marks nodes of a restricted view that may not be edited.
+	readonly bool
+}
+
+// HasOptions reports whether the values of the field are limited to the
+// choices returned by Options.
+func (n *Node) HasOptions() bool {
+	return n.Kind == FieldNode && isChoiceType(n.Input)
+}
+
+// IsSecret reports whether the field is of the secret type, whose value is
+// never rendered back to the page or exported.
+func (n *Node) IsSecret() bool {
+	return n.Kind == FieldNode && n.Input == "secret" && isScalarType(n.Type)
+}
+
+// Options returns the choices of a field for which HasOptions is true. owner
+// is the struct holding the field, or a pointer to it, and parent the config
+// passed to options providers.
+func (n *Node) Options(owner, parent any) []Choice {
+	v := reflect.Indirect(reflect.ValueOf(owner))
+	return n.options(v, parent)
+}
+
+func (n *Node) options(owner reflect.Value, parent any) []Choice {
+	return fieldOptions(owner, n.value(owner), n.Name, parent)
+}
+
+// value returns the field of the node in the struct v.
+func (n *Node) value(v reflect.Value) reflect.Value {
+	return v.FieldByIndex(n.Field.Index)
+}
+
+// tag returns the web tag of the node as parsed by parseTag.
+func (n *Node) tag() Field {
+	return Field{Name: n.Name, Label: n.Label, Type: n.Input, Icon: n.Icon, Status: n.Status, Help: n.Help}
+}
+
+// Section returns the section with the given Go field name, or nil.
+func (s *Schema) Section(name string) *Node {
+	for _, section := range s.Sections {
+		if section.Name == name {
+			return section
+		}
+	}
+	return nil
+}
+
+// SchemaOf returns the schema of the config type T. The schema is a copy of
+// the one the handlers of T use, so changing it does not affect them. Lists
+// whose rows contain the list again, which New rejects, have no Fields.
+func SchemaOf[T any]() *Schema {
+	s := schemaOf(reflect.TypeFor[T]())
+	return &Schema{Type: s.Type, Sections: cloneNodes(s.Sections)}
+}
+
+// cloneNodes returns a deep copy of nodes.
+func cloneNodes(nodes []*Node) []*Node {
+	if nodes == nil {
+		return nil
+	}
+	clones := make([]*Node, len(nodes))
+	for i, n := range nodes {
+		c := *n
+		c.Rules = slices.Clone(n.Rules)
+		c.View = slices.Clone(n.View)
+		c.Edit = slices.Clone(n.Edit)
+		c.Field.Index = slices.Clone(n.Field.Index)
+		c.Fields = cloneNodes(n.Fields)
+		clones[i] = &c
+	}
+	return clones
+}
+
+// schemas caches the *Schema of every config type.
+var schemas sync.Map
+
+func schemaOf(t reflect.Type) *Schema {
+	if s, ok := schemas.Load(t); ok {
+		return s.(*Schema)
+	}
+	s, _ := schemas.LoadOrStore(t, buildSchema(t))
+	return s.(*Schema)
+}
+
+func buildSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: t}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Type.Kind() != reflect.Struct {
+			continue
+		}
+		n := &Node{
+			Kind:   SectionNode,
+			Name:   field.Name,
+			Label:  field.Name,
+			Field:  field,
+			Type:   field.Type,
+			Fields: structNodes(field.Type, field.Name+".", []reflect.Type{field.Type}, &s.err),
+		}
+		n.View, n.Edit = parseAccess(field.Tag.Get("access"))
+		n.restricted = isRestricted(n)
+		s.Sections = append(s.Sections, n)
+	}
+	return s
+}
+
+// structNodes returns the nodes of the fields of the struct t. path is the
+// dotted path of t, and types the struct types enclosing it, down to t. The
+// first list that would enclose its own type again, or secret that is not a
+// single value, is reported in err.
+func structNodes(t reflect.Type, path string, types []reflect.Type, err *error) []*Node {
+	var nodes []*Node
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tag := parseTag(reflect.Zero(field.Type), field)
+		n := &Node{
+			Kind:   FieldNode,
+			Name:   tag.Name,
+			Label:  tag.Label,
+			Input:  tag.Type,
+			Icon:   tag.Icon,
+			Status: tag.Status,
+			Help:   tag.Help,
+			Rules:  parseRules(field.Tag.Get("validate")),
+			Field:  field,
+			Type:   field.Type,
+			set:    setterFor(field.Type),
+		}
+		switch {
+		case isNestedType(field.Type):
+			n.Kind = StructNode
+			n.Fields = structNodes(field.Type, path+n.Name+".", append(types, field.Type), err)
+		case isListType(field.Type):
+			n.Kind = ListNode
+			if elem := field.Type.Elem(); !slices.Contains(types, elem) {
+				n.Fields = structNodes(elem, path+n.Name+".", append(types, elem), err)
+			} else if *err == nil {
+				*err = fmt.Errorf("%s%s: rows of type %v contain the list again", path, n.Name, elem)
+			}
+		case isMapType(field.Type):
+			n.Kind = MapNode
+		}
+		if n.Input == "secret" || n.Input == "password" {
+			if n.Kind != FieldNode || !isScalarType(n.Type) {
+				// Only single values can be kept when submitted empty.
+				if *err == nil {
+					*err = fmt.Errorf("%s%s: %s fields must hold a single value, not %v", path, n.Name, n.Input, n.Type)
+				}
+			} else {
+				// Passwords are secrets, whose values are never rendered
+				// back.
+				n.Input = "secret"
+			}
+		}
+		n.View, n.Edit = parseAccess(field.Tag.Get("access"))
+		n.restricted = isRestricted(n)
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+func isRestricted(n *Node) bool {
+	return len(n.View) > 0 || len(n.Edit) > 0 || slices.ContainsFunc(n.Fields, func(f *Node) bool { return f.restricted })
+}
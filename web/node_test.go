@@ -0,0 +1,144 @@
+package web_test
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gwangyi/webcfg/web"
+)
+
+func TestSchemaOf(t *testing.T) {
+	schema := web.SchemaOf[StoredConfig]()
+	if schema.Type != reflect.TypeFor[StoredConfig]() {
+		t.Errorf("unexpected type %v", schema.Type)
+	}
+	if len(schema.Sections) != 2 || schema.Sections[0].Name != "Server" || schema.Sections[1].Name != "Other" {
+		t.Fatalf("unexpected sections %v", schema.Sections)
+	}
+	if schema.Section("Missing") != nil {
+		t.Errorf("expected no section Missing")
+	}
+
+	server := schema.Section("Server")
+	if server.Kind != web.SectionNode || server.Label != "Server" {
+		t.Errorf("unexpected section %+v", server)
+	}
+	for i, tc := range []struct {
+		name  string
+		kind  web.NodeKind
+		input string
+	}{
+		{"name", web.FieldNode, "text"},
+		{"port", web.FieldNode, "text"},
+		{"ratio", web.FieldNode, "text"},
+		{"enabled", web.FieldNode, "checkbox"},
+		{"custom", web.FieldNode, "text"},
+		{"regions", web.FieldNode, "text"},
+		{"labels", web.MapNode, "text"},
+		{"pool", web.StructNode, "text"},
+		{"backends", web.ListNode, "text"},
+	} {
+		n := server.Fields[i]
+		if n.Name != tc.name || n.Kind != tc.kind || n.Input != tc.input {
+			t.Errorf("field %d: expected %s %v %s, got %s %v %s", i, tc.name, tc.kind, tc.input, n.Name, n.Kind, n.Input)
+		}
+	}
+
+	pool := server.Fields[7]
+	if len(pool.Fields) != 2 || pool.Fields[0].Name != "MaxConns" || pool.Fields[0].Label != "Max Connections" || pool.Fields[1].Name != "MinConns" {
+		t.Errorf("unexpected pool fields %v", pool.Fields)
+	}
+	backends := server.Fields[8]
+	if backends.Type.Kind() != reflect.Slice || len(backends.Fields) != 1 || backends.Fields[0].Name != "host" {
+		t.Errorf("unexpected backends %+v", backends)
+	}
+}
+
+func TestSchemaRules(t *testing.T) {
+	section := web.SchemaOf[ValidatedConfig]().Section("Section")
+	name := section.Fields[0]
+	want := []web.Rule{{Name: "required"}, {Name: "min", Arg: "2"}, {Name: "max", Arg: "5"}}
+	if !reflect.DeepEqual(name.Rules, want) {
+		t.Errorf("expected %v, got %v", want, name.Rules)
+	}
+	slug := section.Fields[4]
+	if len(slug.Rules) != 1 || slug.Rules[0].Arg != "^[a-z]+(-[a-z]+){0,2}$" {
+		t.Errorf("unexpected rules %v", slug.Rules)
+	}
+}
+
+func TestSchemaOptions(t *testing.T) {
+	cfg := &ChoiceConfig{Priorities: []string{"1", "2"}}
+	section := web.SchemaOf[ChoiceConfig]().Section("Section")
+	for _, tc := range []struct {
+		name string
+		want []string
+	}{
+		{"level", []string{"debug", "info", "error"}},
+		{"mode", []string{"active", "passive"}},
+		{"regions", []string{"eu", "us", "ap"}},
+		{"priority", []string{"1", "2"}},
+		{"free", nil},
+	} {
+		var n *web.Node
+		for _, f := range section.Fields {
+			if f.Name == tc.name {
+				n = f
+			}
+		}
+		if n.HasOptions() != (tc.want != nil) {
+			t.Errorf("%s: expected HasOptions %v", tc.name, tc.want != nil)
+			continue
+		}
+		if tc.want == nil {
+			continue
+		}
+		var got []string
+		for _, c := range n.Options(&cfg.Section, cfg) {
+			got = append(got, c.Value)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestSchemaOfCopy(t *testing.T) {
+	schema := web.SchemaOf[StoredConfig]()
+	server := schema.Section("Server")
+	server.Fields[0].Name = "renamed"
+	server.Fields[7].Fields = nil
+	schema.Sections = nil
+
+	schema = web.SchemaOf[StoredConfig]()
+	if server := schema.Section("Server"); server == nil || server.Fields[0].Name != "name" || len(server.Fields[7].Fields) != 2 {
+		t.Errorf("expected changes to a schema not to affect others, got %+v", schema.Sections)
+	}
+	handler, _ := web.New(&StoredConfig{})
+	if body := apiRequest(handler, http.MethodGet, "/api/sections/Server", "").Body.String(); !strings.Contains(body, `"name"`) {
+		t.Errorf("expected changes to a schema not to affect handlers, got %s", body)
+	}
+}
+
+type Rule struct {
+	Name  string `web:"name"`
+	Rules []Rule `web:"rules"`
+}
+
+type RuleConfig struct {
+	Firewall struct {
+		Rules []Rule `web:"rules"`
+	}
+}
+
+func TestSchemaRecursiveList(t *testing.T) {
+	if _, err := web.New(&RuleConfig{}); err == nil || !strings.Contains(err.Error(), "Firewall.rules.rules") {
+		t.Errorf("expected error naming the recursive list, got %v", err)
+	}
+	rules := web.SchemaOf[RuleConfig]().Section("Firewall").Fields[0]
+	if len(rules.Fields) != 2 || rules.Fields[1].Kind != web.ListNode || rules.Fields[1].Fields != nil {
+		t.Errorf("expected the recursive list to have no fields, got %+v", rules.Fields)
+	}
+}
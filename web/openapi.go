@@ -0,0 +1,191 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// WithOpenAPI serves the OpenAPI description of the JSON API at
+// /api/openapi.json. Like the JSON Schema, it is off by default, since it
+// discloses the structure and defaults of the config, and it leaves out
+// sections and fields with view roles.
+func WithOpenAPI() Option {
+	return func(o *configPageOptions) {
+		o.openapi = true
+	}
+}
+
+// OpenAPI returns an OpenAPI 3.1 description of the JSON API of a handler
+// for config, with the values of config as defaults. Handlers given
+// WithOpenAPI serve the same document at /api/openapi.json.
+func OpenAPI[T any](config *T) ([]byte, error) {
+	v := reflect.ValueOf(config).Elem()
+	return json.MarshalIndent(openAPIDocument(v, config, schemaOf(v.Type()).Sections, false, nil), "", "  ")
+}
+
+func schemaRef(name string) object {
+	return object{{"$ref", "#/components/schemas/" + name}}
+}
+
+func jsonContent(schema object) object {
+	return object{{"application/json", object{{"schema", schema}}}}
+}
+
+func errorResponse(description string) object {
+	return object{{"description", description}, {"content", jsonContent(schemaRef("Error"))}}
+}
+
+// openAPIDocument describes the JSON API for the given sections of the
+// config v. parent is passed to options providers, and auth are the
+// authenticators requests need to pass.
+func openAPIDocument(v reflect.Value, parent any, sections []*Node, schema bool, auth []Authenticator) object {
+	t := v.Type()
+	// responses adds the response to requests without credentials, if any
+	// are needed, to the responses of an operation.
+	responses := func(r object) object {
+		if len(auth) > 0 {
+			r = append(r, member{"401", errorResponse("The request has no valid credentials")})
+		}
+		return r
+	}
+	config := object{{"type", "object"}}
+	configProperties := object{}
+	schemas := object{{"Config", nil}}
+	paths := object{{"/api/config", object{{"get", object{
+		{"operationId", "getConfig"},
+		{"summary", "Get the whole config"},
+		{"responses", responses(object{{"200", object{{"description", "The config"}, {"content", jsonContent(schemaRef("Config"))}}}})},
+	}}}}}
+
+	for _, s := range sections {
+		name := s.Name
+		configProperties = append(configProperties, member{name, schemaRef(name)})
+		schemas = append(schemas, member{name, append(object{{"title", s.Label}}, structSchema(s.value(v), s.Fields, parent)...)})
+
+		section := object{{"description", "The " + name + " section"}, {"content", jsonContent(schemaRef(name))}}
+		body := object{{"required", true}, {"content", jsonContent(schemaRef(name))}}
+		update := func(id, summary string) object {
+			return object{
+				{"operationId", id + name},
+				{"summary", summary},
+				{"requestBody", body},
+				{"responses", responses(object{
+					{"200", section},
+					{"400", errorResponse("The body is not valid JSON")},
+					{"403", errorResponse("The request was sent by a page of another origin, or changes fields the principal may not edit")},
+					{"409", errorResponse("The update was rejected by a hook")},
+					{"422", errorResponse("Some fields are invalid, or are set by an environment variable or flag")},
+					{"500", errorResponse("The update could not be saved")},
+				})},
+			}
+		}
+		paths = append(paths, member{"/api/sections/" + name, object{
+			{"get", object{
+				{"operationId", "get" + name},
+				{"summary", "Get the " + name + " section"},
+				{"responses", responses(object{
+					{"200", section},
+					{"403", errorResponse("The principal may not view the section")},
+				})},
+			}},
+			{"put", update("replace", "Replace the "+name+" section, resetting fields missing from the body")},
+			{"patch", update("update", "Update the fields of the "+name+" section present in the body")},
+		}})
+	}
+	schemas[0].Value = append(append(config, member{"title", t.Name()}), member{"properties", configProperties})
+	schemas = append(schemas,
+		member{"Error", object{
+			{"type", "object"},
+			{"required", []string{"error"}},
+			{"properties", object{
+				{"error", object{{"type", "string"}, {"description", "All errors in one message"}}},
+				{"errors", object{{"type", "array"}, {"items", schemaRef("FieldError")}}},
+			}},
+		}},
+		member{"FieldError", object{
+			{"type", "object"},
+			{"required", []string{"field", "code", "message"}},
+			{"properties", object{
+				{"field", object{{"type", "string"}, {"description", "Path of the field, such as Section.list.0.name"}}},
+				{"code", object{{"type", "string"}, {"description", "parse for values that cannot be parsed, unknown for keys that are not fields, unsupported for fields that cannot be set, forbidden for fields the principal may not edit, overridden for fields set by an environment variable or flag, or the failed validation rule"}}},
+				{"message", object{{"type", "string"}}},
+			}},
+		}},
+	)
+
+	if schema {
+		paths = append(paths, member{"/api/schema", object{{"get", object{
+			{"operationId", "getSchema"},
+			{"summary", "Get the JSON Schema of the config"},
+			{"responses", responses(object{{"200", object{{"description", "The JSON Schema"}, {"content", object{{"application/schema+json", object{}}}}}}})},
+		}}}})
+	}
+
+	components := object{{"schemas", schemas}}
+	doc := object{
+		{"openapi", "3.1.0"},
+		{"jsonSchemaDialect", jsonSchemaDialect},
+		{"info", object{{"title", t.Name()}, {"version", "1.0.0"}}},
+		{"paths", paths},
+	}
+	if schemes := securitySchemes(auth); len(schemes) > 0 {
+		components = append(components, member{"securitySchemes", schemes})
+		// Any one of the schemes authenticates a request.
+		security := make([]object, len(schemes))
+		for i, scheme := range schemes {
+			security[i] = object{{scheme.Key, []string{}}}
+		}
+		doc = append(doc, member{"security", security})
+	}
+	return append(doc, member{"components", components})
+}
+
+// securitySchemes describes the built-in authenticators among auth.
+// Other authenticators cannot be described.
+func securitySchemes(auth []Authenticator) object {
+	schemes := object{}
+	add := func(name string, scheme object) {
+		if _, ok := lookup(schemes, name); !ok {
+			schemes = append(schemes, member{name, scheme})
+		}
+	}
+	for _, a := range auth {
+		switch a := a.(type) {
+		case *basicAuth:
+			add("basicAuth", object{{"type", "http"}, {"scheme", "basic"}})
+		case bearerTokens:
+			add("bearerAuth", object{{"type", "http"}, {"scheme", "bearer"}})
+		case *trustedHeader:
+			add("trustedHeader", object{{"type", "apiKey"}, {"in", "header"}, {"name", a.header}, {"description", "Set by a trusted reverse proxy"}})
+		}
+	}
+	return schemes
+}
+
+// marshalMembers marshals the values of obj ahead of time, so that it can be
+// served without being encoded again and without reading the config.
+func marshalMembers(obj object) (object, error) {
+	marshaled := make(object, len(obj))
+	for i, m := range obj {
+		data, err := json.Marshal(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		marshaled[i] = member{m.Key, json.RawMessage(data)}
+	}
+	return marshaled, nil
+}
+
+// serveOpenAPI serves the OpenAPI document with the base path of the handler
+// as its server, since the paths of the document are relative to it.
+func (p *Handler[T]) serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	server := strings.TrimSuffix(p.basePath(r), "/")
+	if server == "" {
+		server = "/"
+	}
+	doc := slices.Insert(slices.Clone(p.openapi), 3, member{"servers", []object{{{"url", server}}}})
+	writeJSON(w, http.StatusOK, doc)
+}
@@ -0,0 +1,143 @@
+package web_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gwangyi/webcfg/web"
+)
+
+func TestOpenAPI(t *testing.T) {
+	handler, _ := web.New(&NestedConfig{})
+	if rr := apiRequest(handler, http.MethodGet, "/api/openapi.json", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected the document to be disabled by default, got %d", rr.Code)
+	}
+
+	handler, _ = web.New(&NestedConfig{}, web.WithSchema(), web.WithOpenAPI())
+	rr := apiRequest(handler, http.MethodGet, "/api/openapi.json", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d", rr.Code)
+	}
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Title string
+		}
+		Servers []struct {
+			URL string
+		}
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			RequestBody struct {
+				Content map[string]struct {
+					Schema map[string]any
+				}
+			} `json:"requestBody"`
+			Responses map[string]any
+		}
+		Components struct {
+			Schemas map[string]map[string]any
+		}
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid document: %v", err)
+	}
+	if doc.OpenAPI != "3.1.0" || doc.Info.Title != "NestedConfig" {
+		t.Errorf("unexpected header %+v", doc)
+	}
+	if len(doc.Servers) != 1 || doc.Servers[0].URL != "/" {
+		t.Errorf("expected the handler to be the server, got %+v", doc.Servers)
+	}
+	for _, path := range []string{"/api/config", "/api/sections/Database", "/api/schema"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("expected path %s", path)
+		}
+	}
+
+	section := doc.Paths["/api/sections/Database"]
+	if section["patch"].OperationID != "updateDatabase" || section["put"].OperationID != "replaceDatabase" {
+		t.Errorf("unexpected operations %+v", section)
+	}
+	if ref := section["put"].RequestBody.Content["application/json"].Schema["$ref"]; ref != "#/components/schemas/Database" {
+		t.Errorf("unexpected request schema %v", ref)
+	}
+	if _, ok := section["put"].Responses["422"]; !ok {
+		t.Errorf("expected validation error response")
+	}
+	for _, name := range []string{"Config", "Database", "Error", "FieldError"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("expected schema %s", name)
+		}
+	}
+
+	data, err := web.OpenAPI(&NestedConfig{})
+	var standalone struct {
+		Paths map[string]any
+	}
+	if err != nil || json.Unmarshal(data, &standalone) != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := standalone.Paths["/api/schema"]; ok || len(standalone.Paths) != 2 {
+		t.Errorf("expected no schema endpoint in the standalone document")
+	}
+}
+
+func TestOpenAPIServer(t *testing.T) {
+	handler, _ := web.New(&NestedConfig{}, web.WithOpenAPI())
+	rr := apiRequest(http.StripPrefix("/admin/config", handler), http.MethodGet, "/admin/config/api/openapi.json", "")
+	var doc struct {
+		Servers []struct {
+			URL string
+		}
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid document: %v", err)
+	}
+	if len(doc.Servers) != 1 || doc.Servers[0].URL != "/admin/config" {
+		t.Errorf("expected the mount of the handler to be the server, got %+v", doc.Servers)
+	}
+}
+
+func TestOpenAPIAuth(t *testing.T) {
+	handler, _ := web.New(&NestedConfig{}, web.WithOpenAPI(), web.WithAuth(
+		web.BasicAuth("Config", nil),
+		web.BearerTokens(map[string]string{"token": "bob"}),
+	))
+	req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var doc struct {
+		Security []map[string][]string
+		Paths    map[string]map[string]struct {
+			Responses map[string]any
+		}
+		Components struct {
+			SecuritySchemes map[string]struct {
+				Type   string
+				Scheme string
+			}
+		}
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid document: %v", err)
+	}
+	if len(doc.Security) != 2 || doc.Components.SecuritySchemes["basicAuth"].Scheme != "basic" || doc.Components.SecuritySchemes["bearerAuth"].Scheme != "bearer" {
+		t.Errorf("unexpected security %+v %+v", doc.Security, doc.Components.SecuritySchemes)
+	}
+	for _, method := range []string{"get", "put", "patch"} {
+		if _, ok := doc.Paths["/api/sections/Database"][method].Responses["401"]; !ok {
+			t.Errorf("expected %s to document 401", method)
+		}
+	}
+
+	data, _ := web.OpenAPI(&NestedConfig{})
+	if strings.Contains(string(data), "security") || strings.Contains(string(data), `"401"`) {
+		t.Errorf("expected no security without authenticators")
+	}
+}
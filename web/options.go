@@ -0,0 +1,120 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var ErrInvalidChoice = errors.New("invalid choice")
+
+// Choice is a selectable value of a select, radio or multiselect field.
+type Choice struct {
+	Value    string
+	Label    string
+	Selected bool
+}
+
+// OptionsProvider is implemented by field types whose values are restricted
+// to a set of choices. Such fields are rendered as a select by default.
+type OptionsProvider interface {
+	Options(parent any) []Choice
+}
+
+// FieldOptionsProvider is implemented by sections (or nested structs) to
+// supply the choices of their fields, identified by their tag name.
+type FieldOptionsProvider interface {
+	FieldOptions(field string, parent any) []Choice
+}
+
+var optionsProviderType = reflect.TypeFor[OptionsProvider]()
+
+func isChoiceType(typ string) bool {
+	return typ == "select" || typ == "radio" || typ == "multiselect"
+}
+
+func providesOptions(t reflect.Type) bool {
+	return t.Implements(optionsProviderType) || reflect.PointerTo(t).Implements(optionsProviderType)
+}
+
+// fieldOptions returns the choices of the field fv named name in the struct
+// owner. The field type takes precedence over the owner.
+func fieldOptions(owner, fv reflect.Value, name string, parent any) []Choice {
+	t := fv.Type()
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if providesOptions(t) {
+		op := reflect.New(t)
+		if t == fv.Type() {
+			op.Elem().Set(fv)
+		}
+		return op.Interface().(OptionsProvider).Options(parent)
+	}
+
+	if owner.CanAddr() {
+		if fop, ok := owner.Addr().Interface().(FieldOptionsProvider); ok {
+			return fop.FieldOptions(name, parent)
+		}
+	}
+	return nil
+}
+
+// selectChoices returns a copy of choices with the given values selected.
+func selectChoices(choices []Choice, values ...string) []Choice {
+	selected := map[string]bool{}
+	for _, v := range values {
+		selected[v] = true
+	}
+	result := make([]Choice, len(choices))
+	for i, c := range choices {
+		if c.Label == "" {
+			c.Label = c.Value
+		}
+		c.Selected = selected[c.Value]
+		result[i] = c
+	}
+	return result
+}
+
+func checkChoice(choices []Choice, value string) *ParseError {
+	for _, c := range choices {
+		if c.Value == value {
+			return nil
+		}
+	}
+	return &ParseError{Message: "invalid value", Err: fmt.Errorf("%w %q", ErrInvalidChoice, value)}
+}
+
+// handleChoices sets the choice field v from the submitted values, rejecting
+// values that are not among choices. Multiselect fields are slices of
+// scalars and receive every submitted value. A radio field with no choice
+// checked posts nothing, in which case v is kept.
+func handleChoices(v reflect.Value, choices []Choice, typ string, values []string) *ParseError {
+	if typ != "multiselect" {
+		if len(values) == 0 {
+			return nil
+		}
+		if err := checkChoice(choices, values[0]); err != nil {
+			return err
+		}
+		return handleField(v, values[0])
+	}
+
+	if v.Kind() != reflect.Slice {
+		return &ParseError{Message: "invalid field", Err: fmt.Errorf("multiselect fields must be slices, not %s", v.Type())}
+	}
+	list := reflect.MakeSlice(v.Type(), 0, len(values))
+	for _, value := range values {
+		if err := checkChoice(choices, value); err != nil {
+			return err
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := handleField(elem, value); err != nil {
+			return err
+		}
+		list = reflect.Append(list, elem)
+	}
+	v.Set(list)
+	return nil
+}
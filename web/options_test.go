@@ -0,0 +1,146 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gwangyi/webcfg/web"
+)
+
+type LogLevel string
+
+func (LogLevel) Options(parent any) []web.Choice {
+	return []web.Choice{
+		{Value: "debug", Label: "Debug"},
+		{Value: "info", Label: "Info"},
+		{Value: "error"},
+	}
+}
+
+type ChoiceSection struct {
+	Level    LogLevel `web:"level,Log Level"`
+	Mode     string   `web:"mode,Mode,radio"`
+	Regions  []string `web:"regions,Regions,multiselect"`
+	Priority int      `web:"priority,Priority,select"`
+	Free     string   `web:"free,Free"`
+}
+
+func (s *ChoiceSection) FieldOptions(field string, parent any) []web.Choice {
+	switch field {
+	case "mode":
+		return []web.Choice{{Value: "active"}, {Value: "passive"}}
+	case "regions":
+		return []web.Choice{{Value: "eu"}, {Value: "us"}, {Value: "ap"}}
+	case "priority":
+		cfg := parent.(*ChoiceConfig)
+		choices := []web.Choice{}
+		for _, p := range cfg.Priorities {
+			choices = append(choices, web.Choice{Value: p})
+		}
+		return choices
+	}
+	return nil
+}
+
+type ChoiceConfig struct {
+	Section    ChoiceSection
+	Priorities []string
+}
+
+func TestChoiceRendering(t *testing.T) {
+	cfg := &ChoiceConfig{Priorities: []string{"1", "2"}}
+	cfg.Section = ChoiceSection{Level: "info", Mode: "passive", Regions: []string{"eu", "ap"}, Priority: 2}
+	handler, _ := web.New(cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	for _, want := range []string{
+		`<select id="level" name="level">`,
+		`<option value="info" selected>Info</option>`,
+		`<option value="debug">Debug</option>`,
+		`<option value="error">error</option>`,
+		`name="mode" type="radio" value="passive" checked`,
+		`name="mode" type="radio" value="active">`,
+		`<select id="regions" name="regions" multiple>`,
+		`<option value="eu" selected>eu</option>`,
+		`<option value="us">us</option>`,
+		`<option value="ap" selected>ap</option>`,
+		`<option value="2" selected>2</option>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in body", want)
+		}
+	}
+}
+
+func TestChoiceUpdate(t *testing.T) {
+	cfg := &ChoiceConfig{Priorities: []string{"1", "2"}}
+	handler, _ := web.New(cfg)
+
+	valid := func() url.Values {
+		return url.Values{
+			"level":    {"debug"},
+			"mode":     {"active"},
+			"regions":  {"us", "eu"},
+			"priority": {"1"},
+			"free":     {"anything"},
+		}
+	}
+
+	c := &client{}
+	c.post(handler, "/Section", valid())
+	if cfg.Section.Level != "debug" || cfg.Section.Mode != "active" || cfg.Section.Priority != 1 || cfg.Section.Free != "anything" {
+		t.Errorf("unexpected section: %+v", cfg.Section)
+	}
+	if len(cfg.Section.Regions) != 2 || cfg.Section.Regions[0] != "us" || cfg.Section.Regions[1] != "eu" {
+		t.Errorf("unexpected regions: %v", cfg.Section.Regions)
+	}
+
+	t.Run("no choice checked", func(t *testing.T) {
+		form := valid()
+		form.Del("mode")
+		form.Set("free", "unchecked")
+		c := &client{}
+		c.post(handler, "/Section", form)
+		if cfg.Section.Mode != "active" || cfg.Section.Free != "unchecked" {
+			t.Errorf("expected the mode to be kept, got %+v", cfg.Section)
+		}
+	})
+
+	for _, field := range []string{"level", "mode", "regions", "priority"} {
+		t.Run(field, func(t *testing.T) {
+			form := valid()
+			form.Set(field, "bogus")
+			c := &client{}
+			c.post(handler, "/Section", form)
+			if body := c.get(handler); !strings.Contains(body, "invalid choice") {
+				t.Errorf("expected invalid choice error")
+			}
+		})
+	}
+}
+
+type MisusedChoiceSection struct {
+	Region string `web:"region,Region,multiselect"`
+}
+
+func (s *MisusedChoiceSection) FieldOptions(field string, parent any) []web.Choice {
+	return []web.Choice{{Value: "eu"}, {Value: "us"}}
+}
+
+func TestMultiselectRequiresSlice(t *testing.T) {
+	cfg := &struct{ Section MisusedChoiceSection }{}
+	handler, _ := web.New(cfg)
+
+	c := &client{}
+	c.post(handler, "/Section", url.Values{"region": {"eu"}})
+	if body := c.get(handler); !strings.Contains(body, "multiselect fields must be slices") {
+		t.Errorf("expected the submission to be rejected")
+	}
+}
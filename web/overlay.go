@@ -0,0 +1,133 @@
+package web
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// overlay is a value for a field set from outside the store, such as from
+// an environment variable. Overlaid fields cannot be edited in the UI and
+// are saved to the store with the value they had before the overlay.
+type overlay struct {
+	index  []int  // field index from the root config
+	path   string // canonical path, such as Database.pool.max
+	source string // shown next to the field, such as $APP_DATABASE_HOST
+	value  string
+}
+
+// applyOverlays sets the overlays on the config v in order and returns the
+// values they replaced.
+func applyOverlays(v reflect.Value, overlays []overlay) ([]reflect.Value, error) {
+	var errs ValidationError
+	stored := make([]reflect.Value, len(overlays))
+	for i, o := range overlays {
+		field := v.FieldByIndex(o.index)
+		stored[i] = reflect.New(field.Type()).Elem()
+		stored[i].Set(field)
+		if err := setText(field, o.value); err != nil {
+			err.Field = o.path
+			errs.add(&FieldError{Field: o.path, Code: "parse", Message: err.Message + " from " + o.source + ": " + err.Err.Error(), Err: err})
+		}
+	}
+	if len(errs.Errors) > 0 {
+		return nil, &errs
+	}
+	return stored, nil
+}
+
+func (p *Handler[T]) applyOverlays() error {
+	stored, err := applyOverlays(reflect.ValueOf(p.config).Elem(), p.overlays)
+	if err != nil {
+		return fmt.Errorf("apply overlays: %w", err)
+	}
+	p.stored = stored
+	p.sources = overlaySources(p.overlays)
+	return nil
+}
+
+// restoreOverlays undoes applyOverlays on v.
+func restoreOverlays(v reflect.Value, overlays []overlay, stored []reflect.Value) {
+	for i := len(overlays) - 1; i >= 0; i-- {
+		v.FieldByIndex(overlays[i].index).Set(stored[i])
+	}
+}
+
+// setText is handleField for values typed by a person rather than posted by
+// a form, so that booleans are parsed strictly.
+func setText(v reflect.Value, s string) *ParseError {
+	if v.Kind() == reflect.Bool {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return &ParseError{Message: "invalid boolean", Err: err}
+		}
+		v.SetBool(b)
+		return nil
+	}
+	return handleField(v, s)
+}
+
+// overlayField is a field that overlays can set.
+type overlayField struct {
+	index []int
+	path  string
+	name  string // name of the variable or flag setting the field
+	node  *Node
+	value reflect.Value
+}
+
+// overlayFields returns the scalar fields outside lists of the config v.
+// Their names join prefix with the names of the section and fields using
+// join. A tagKey tag sets the full name of a field instead, and "-" skips it.
+func overlayFields(v reflect.Value, prefix, tagKey string, join func(prefix, name string) string) []overlayField {
+	var fields []overlayField
+	for _, section := range schemaOf(v.Type()).Sections {
+		collectOverlayFields(section.value(v), section.Fields, section.Field.Index, section.Name+".", join(prefix, section.Name), tagKey, join, &fields)
+	}
+	return fields
+}
+
+func collectOverlayFields(v reflect.Value, nodes []*Node, index []int, path, name, tagKey string, join func(prefix, name string) string, fields *[]overlayField) {
+	for _, n := range nodes {
+		fieldName := join(name, n.Name)
+		if explicit, ok := n.Field.Tag.Lookup(tagKey); ok {
+			fieldName = explicit
+		}
+		if fieldName == "-" {
+			continue
+		}
+		fieldIndex := append(index[:len(index):len(index)], n.Field.Index...)
+
+		switch {
+		case n.Kind == StructNode:
+			collectOverlayFields(n.value(v), n.Fields, fieldIndex, path+n.Name+".", fieldName, tagKey, join, fields)
+		case n.Kind == FieldNode && isScalarType(n.Type):
+			*fields = append(*fields, overlayField{index: fieldIndex, path: path + n.Name, name: fieldName, node: n, value: n.value(v)})
+		}
+	}
+}
+
+// overlaySources returns the source of every overlaid field by path.
+func overlaySources(overlays []overlay) map[string]string {
+	sources := map[string]string{}
+	for _, o := range overlays {
+		sources[o.path] = o.source
+	}
+	return sources
+}
+
+// applySources marks the fields of section set by an overlay as read-only
+// and shows where their value came from. prefix is the path prefix of the
+// section.
+func applySources(section *Section, prefix string, sources map[string]string) {
+	for i := range section.Fields {
+		f := &section.Fields[i]
+		if source, ok := sources[prefix+f.Name]; ok {
+			f.Readonly = true
+			f.Source = source
+		}
+	}
+	for i := range section.Subsections {
+		applySources(&section.Subsections[i], prefix, sources)
+	}
+}
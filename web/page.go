@@ -1,16 +1,23 @@
 package web
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
+	"net/url"
 	"reflect"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/crazy3lf/colorconv"
 )
 
+// Field is an input of a form. The Value of secret fields is never set;
+// Set tells whether they have one instead.
 type Field struct {
 	Name     string
 	Label    string
@@ -20,13 +27,43 @@ type Field struct {
 	Status   string
 	Help     string
 	Readonly bool
+	Set      bool
+	Source   string
+	Options  []Choice
 }
 
+// Section is a form of the page, or a group of fields in it. Name is the
+// dotted path of subsections, under which their errors are reported.
+// Readonly sections and rows may be viewed but not changed.
 type Section struct {
+	Title       string
+	Name        string
+	Subtitle    string
+	Action      string
+	Help        string
+	Readonly    bool
+	Fields      []Field
+	Subsections []Section
+	Lists       []List
+}
+
+// List is a slice of structs or a map rendered as repeatable rows. Each row
+// posts its key under the list name, in display order, and its fields under
+// Name.Key.Field. Map rows have the fields key and value.
+type List struct {
 	Title    string
-	Subtitle string
-	Action   string
-	Fields   []Field
+	Name     string
+	Help     string
+	Readonly bool
+	Rows     []Row
+	Template Row
+}
+
+type Row struct {
+	Section
+	List     string
+	Key      string
+	Sortable bool
 }
 
 type Notification struct {
@@ -40,6 +77,11 @@ type Page struct {
 	Notifications []Notification
 	Sections      []Section
 	HasAssets     bool
+	// Base is the path the handler is mounted at, ending with a slash.
+	// Links, form actions and assets are relative to it.
+	Base string
+	// CSRFToken is posted with every form, unless CSRF protection is off.
+	CSRFToken string
 }
 
 type Theme struct {
@@ -56,8 +98,19 @@ type Theme struct {
 type Option func(*configPageOptions)
 
 type configPageOptions struct {
-	assets fs.FS
-	theme  *Theme
+	assets  fs.FS
+	theme   *Theme
+	store   any
+	watch   time.Duration
+	env     *string
+	flags   *flag.FlagSet
+	schema  bool
+	openapi bool
+	base    string
+	noCSRF  bool
+	auth    []Authenticator
+	roles   map[string][]string
+	audit   func(Change)
 }
 
 func WithAssets(assets fs.FS) Option {
@@ -72,11 +125,48 @@ func WithTheme(theme *Theme) Option {
 	}
 }
 
-type configPage[T any] struct {
-	Page
+// WithBasePath sets the path the handler is mounted at, such as
+// /admin/config/. Without it, the path is taken from the part of the request
+// URI that http.StripPrefix or a router removed before calling the handler.
+func WithBasePath(base string) Option {
+	return func(o *configPageOptions) {
+		o.base = base
+	}
+}
+
+// WithoutCSRF turns off the protection against cross-site request forgery,
+// which is on by default. Form submissions then no longer need the token
+// embedded in the page, and the JSON API accepts requests from other
+// origins.
+func WithoutCSRF() Option {
+	return func(o *configPageOptions) {
+		o.noCSRF = true
+	}
+}
+
+// Handler serves the configuration page for T and guards every access to
+// the underlying config with a read/write lock. Application code sharing the
+// config with the handler should go through Read, Snapshot and Update.
+type Handler[T any] struct {
+	mu            sync.RWMutex
 	config        *T
 	assetsHandler http.Handler
 	theme         *Theme
+	store         Store[T]
+	sessions      *sessionStore
+	watcher       *watcher
+	// overlays are applied on top of the stored config, replacing the
+	// values in stored.
+	overlays []overlay
+	stored   []reflect.Value
+	sources  map[string]string
+	schema   []byte
+	openapi  object
+	base     string
+	csrf     bool
+	auth     []Authenticator
+	roles    map[string][]string
+	audit    func(Change)
 }
 
 type Notifier interface {
@@ -87,6 +177,49 @@ func (p *Page) Notify(n Notification) {
 	p.Notifications = append(p.Notifications, n)
 }
 
+// Notify broadcasts n to every client. Notifications caused by a request
+// are delivered only to the client that made it.
+func (p *Handler[T]) Notify(n Notification) {
+	p.sessions.broadcast(n)
+}
+
+// Read calls fn with the config while holding the read lock.
+// fn must not retain the pointer or call Update.
+func (p *Handler[T]) Read(fn func(*T)) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	fn(p.config)
+}
+
+// Snapshot returns a shallow copy of the config taken under the read lock.
+func (p *Handler[T]) Snapshot() T {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return *p.config
+}
+
+// Update calls fn with a copy of the config while holding the write lock,
+// then applies the copy and saves it to the store, if any. If fn returns an
+// error or the config cannot be saved, the config is left untouched. The
+// copy is shallow, so fn must replace rather than modify the maps and slices
+// it changes. fn must not retain the pointer or call Read, Snapshot or
+// Update.
+func (p *Handler[T]) Update(fn func(*T) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	config := *p.config
+	if err := fn(&config); err != nil {
+		return err
+	}
+	previous := *p.config
+	*p.config = config
+	if err := p.save(); err != nil {
+		*p.config = previous
+		return err
+	}
+	return nil
+}
+
 type Initializable interface {
 	Initialize(parent any, n Notifier) error
 }
@@ -117,7 +250,7 @@ func writeBulmaColorVar(w io.Writer, name, val string) error {
 	return nil
 }
 
-func (p *configPage[T]) serveCustomCSS(w http.ResponseWriter) {
+func (p *Handler[T]) serveCustomCSS(w http.ResponseWriter) {
 	if p.theme == nil {
 		http.NotFound(w, nil)
 		return
@@ -126,7 +259,10 @@ func (p *configPage[T]) serveCustomCSS(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "text/css")
 	w.Write([]byte(":root {\n"))
 
+	// The theme may point into the config itself, e.g. WithTheme(&cfg.Theme).
+	p.mu.RLock()
 	v := reflect.ValueOf(*p.theme)
+	p.mu.RUnlock()
 	typ := v.Type()
 	for i := 0; i < v.NumField(); i++ {
 		sf := typ.Field(i)
@@ -150,6 +286,8 @@ func parseTag(v reflect.Value, sf reflect.StructField) Field {
 	}
 	if v.Kind() == reflect.Bool {
 		f.Type = "checkbox"
+	} else if providesOptions(v.Type()) {
+		f.Type = "select"
 	}
 
 	tag := sf.Tag.Get("web")
@@ -179,7 +317,7 @@ func parseTag(v reflect.Value, sf reflect.StructField) Field {
 	return f
 }
 
-func (p *configPage[T]) initialize() error {
+func (p *Handler[T]) initialize() error {
 	v := reflect.ValueOf(p.config).Elem()
 	for i := 0; i < v.NumField(); i++ {
 		fieldVal := v.Field(i)
@@ -199,7 +337,7 @@ func (p *configPage[T]) initialize() error {
 	return nil
 }
 
-func (p *configPage[T]) serveAssets(w http.ResponseWriter, r *http.Request) {
+func (p *Handler[T]) serveAssets(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
 
 	if path == "/assets/css/custom.css" {
@@ -218,52 +356,209 @@ func (p *configPage[T]) serveAssets(w http.ResponseWriter, r *http.Request) {
 	embeddedAssetsHandler.ServeHTTP(w, r)
 }
 
-func (p *configPage[T]) servePost(w http.ResponseWriter, r *http.Request) {
+// basePath returns the path the handler is mounted at for r, ending with a
+// slash.
+func (p *Handler[T]) basePath(r *http.Request) string {
+	if p.base != "" {
+		return p.base
+	}
+	uri, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil {
+		return "/"
+	}
+	prefix, ok := strings.CutSuffix(uri.EscapedPath(), r.URL.EscapedPath())
+	if !ok {
+		// The router may have removed the path up to and including the
+		// final slash, e.g. /admin/config from /admin/config.
+		if r.URL.Path != "/" {
+			return "/"
+		}
+		prefix = uri.EscapedPath()
+	}
+	return cleanBase(prefix)
+}
+
+// cleanBase returns base with a single leading and trailing slash, so that
+// it never becomes a scheme-relative URL such as //example.com/.
+func cleanBase(base string) string {
+	base = strings.Trim(base, "/")
+	if base == "" {
+		return "/"
+	}
+	return "/" + base + "/"
+}
+
+// csrfField is the name of the form value holding the CSRF token. Clients
+// other than the page can send it in the csrfHeader header instead.
+const (
+	csrfField  = "_csrf"
+	csrfHeader = "X-CSRF-Token"
+)
+
+func (p *Handler[T]) servePost(w http.ResponseWriter, r *http.Request) {
 	sectionName := strings.TrimPrefix(r.URL.Path, "/")
-	if err := p.updateConfig(sectionName, r); err != nil {
-		p.Notify(Notification{Message: "Update failed: " + err.Error(), Status: "danger"})
+	if p.csrf {
+		token := r.Header.Get(csrfHeader)
+		if token == "" {
+			token = r.PostFormValue(csrfField)
+		}
+		id := p.sessions.lookup(r)
+		if !p.sessions.validToken(id, token) {
+			if id == "" && len(r.CookiesNamed(sessionCookieName)) > 0 && r.Header.Get(csrfHeader) == "" {
+				// The session of the page expired, was evicted or was lost
+				// in a restart. Cross-site posts do not carry the cookie.
+				id = p.sessions.start(w, r, p.basePath(r))
+				p.sessions.flash(id, Notification{Message: "Your session expired, so the changes were not saved. Please submit them again.", Status: "warning"})
+				http.Redirect(w, r, p.basePath(r), http.StatusSeeOther)
+				return
+			}
+			http.Error(w, "invalid CSRF token", http.StatusForbidden)
+			return
+		}
+	}
+	// The outcome is flashed to the session of the client.
+	id := p.sessions.start(w, r, p.basePath(r))
+	n := &sessionNotifier{store: p.sessions, id: id}
+	if sub, err := p.updateConfig(sectionName, r, n); err != nil {
+		if sub != nil {
+			p.sessions.reject(id, sub)
+		}
+		n.Notify(Notification{Message: "Update failed: " + err.Error(), Status: "danger"})
 	} else {
-		p.Notify(Notification{Message: "Section updated successfully", Status: "success"})
+		n.Notify(Notification{Message: "Section updated successfully", Status: "success"})
 	}
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	http.Redirect(w, r, p.basePath(r), http.StatusSeeOther)
 }
 
-func (p *configPage[T]) serveIndex(w http.ResponseWriter) {
-	p.buildPage()
-	if err := p.writeIndex(w); err != nil {
+func (p *Handler[T]) serveIndex(w http.ResponseWriter, r *http.Request) {
+	// A session is needed to embed a CSRF token in the forms, or to show
+	// broadcasts only once.
+	id := p.sessions.lookup(r)
+	if id == "" && (p.csrf || p.sessions.hasBroadcasts()) {
+		id = p.sessions.start(w, r, p.basePath(r))
+	}
+	notifications, sub := p.sessions.take(id)
+	page := p.buildPage(sub, principalFrom(r.Context()))
+	page.Notifications = notifications
+	page.Base = p.basePath(r)
+	if p.csrf {
+		page.CSRFToken = p.sessions.token(id)
+	}
+	if err := page.writeIndex(w); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
-	// Clear notifications after rendering
-	p.Notifications = nil
 }
 
-func (p *configPage[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+func (p *Handler[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Routers stripping a prefix may leave the path empty or without its
+	// leading slash.
+	if !strings.HasPrefix(r.URL.Path, "/") {
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = "/" + r.URL.Path
+		r2.URL.RawPath = ""
+		r = r2
+	}
+	r, ok := p.authenticate(r)
+	if !ok {
+		p.unauthorized(w, r)
+		return
+	}
 	switch {
 	case strings.HasPrefix(r.URL.Path, "/assets/"):
 		p.serveAssets(w, r)
+	case strings.HasPrefix(r.URL.Path, "/api/"):
+		p.serveAPI(w, r)
 	case r.Method == http.MethodPost:
 		p.servePost(w, r)
 	case r.URL.Path == "/" || r.URL.Path == "/index.html":
-		p.serveIndex(w)
+		p.serveIndex(w, r)
 	default:
 		http.NotFound(w, r)
 	}
 }
 
-func New[T any](config *T, opts ...Option) (http.Handler, error) {
+func New[T any](config *T, opts ...Option) (*Handler[T], error) {
 	options := &configPageOptions{}
 	for _, o := range opts {
 		o(options)
 	}
+	if err := schemaOf(reflect.TypeFor[T]()).err; err != nil {
+		return nil, err
+	}
+	for _, auth := range options.auth {
+		if c, ok := auth.(checker); ok {
+			if err := c.check(); err != nil {
+				return nil, err
+			}
+		}
+	}
 
 	var assetsHandler http.Handler
 	if options.assets != nil {
 		assetsHandler = http.StripPrefix("/assets/", http.FileServer(http.FS(options.assets)))
 	}
-	cfg := &configPage[T]{config: config, assetsHandler: assetsHandler, theme: options.theme}
+	cfg := &Handler[T]{
+		config:        config,
+		assetsHandler: assetsHandler,
+		theme:         options.theme,
+		sessions:      newSessionStore(),
+		csrf:          !options.noCSRF,
+		auth:          options.auth,
+		roles:         options.roles,
+		audit:         options.audit,
+	}
+	if options.base != "" {
+		cfg.base = cleanBase(options.base)
+	}
+	// The served documents only describe what principals without roles may
+	// view.
+	sections := publicSections(schemaOf(reflect.TypeFor[T]()).Sections)
+	if options.schema {
+		schema, err := json.MarshalIndent(configSchema(reflect.ValueOf(config).Elem(), config, sections), "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("schema: %w", err)
+		}
+		cfg.schema = schema
+	}
+	if options.openapi {
+		openapi, err := marshalMembers(openAPIDocument(reflect.ValueOf(config).Elem(), config, sections, options.schema, options.auth))
+		if err != nil {
+			return nil, fmt.Errorf("openapi: %w", err)
+		}
+		cfg.openapi = openapi
+	}
+	if options.store != nil {
+		store, ok := options.store.(Store[T])
+		if !ok {
+			return nil, fmt.Errorf("store %T does not store %T", options.store, config)
+		}
+		if err := store.Load(config); err != nil {
+			return nil, fmt.Errorf("load config: %w", err)
+		}
+		cfg.store = store
+	}
+	if options.env != nil {
+		cfg.overlays = envOverlays(reflect.ValueOf(config).Elem(), *options.env)
+	}
+	if options.flags != nil {
+		cfg.overlays = append(cfg.overlays, flagOverlays(reflect.ValueOf(config).Elem(), options.flags)...)
+	}
+	if err := cfg.applyOverlays(); err != nil {
+		return nil, err
+	}
 	err := cfg.initialize()
 	if err != nil {
 		return nil, err
 	}
+	if options.watch > 0 {
+		ps, ok := cfg.store.(pathStore)
+		if !ok {
+			return nil, fmt.Errorf("store %T cannot be watched", cfg.store)
+		}
+		cfg.watch(ps.Path(), options.watch)
+	}
 	return cfg, nil
 }
@@ -4,6 +4,10 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"testing/fstest"
 
@@ -146,3 +150,157 @@ func TestNewHandler(t *testing.T) {
 		}
 	})
 }
+
+func TestHandlerAccessors(t *testing.T) {
+	cfg := &TestConfig{}
+	handler, err := web.New(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := handler.Update(func(c *TestConfig) error {
+		c.Section1.StringField = "updated"
+		return nil
+	}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	var got string
+	handler.Read(func(c *TestConfig) {
+		got = c.Section1.StringField
+	})
+	if got != "updated" {
+		t.Errorf("expected 'updated', got %s", got)
+	}
+
+	snapshot := handler.Snapshot()
+	snapshot.Section1.StringField = "changed"
+	if cfg.Section1.StringField != "updated" {
+		t.Errorf("expected snapshot to be a copy")
+	}
+
+	updateErr := errors.New("update error")
+	if err := handler.Update(func(c *TestConfig) error {
+		c.Section1.StringField = "rejected"
+		return updateErr
+	}); !errors.Is(err, updateErr) {
+		t.Errorf("expected update error, got %v", err)
+	}
+	if cfg.Section1.StringField != "updated" {
+		t.Errorf("expected a failed update to be discarded, got %q", cfg.Section1.StringField)
+	}
+}
+
+func TestHandlerConcurrentAccess(t *testing.T) {
+	cfg := &TestConfig{}
+	handler, _ := web.New(cfg)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			form := url.Values{}
+			form.Add("IntField", strconv.Itoa(i))
+			req := httptest.NewRequest(http.MethodPost, "/Section1", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			addCSRF(handler, req)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+		go func() {
+			defer wg.Done()
+			_ = handler.Snapshot().Section1.IntField
+		}()
+	}
+	wg.Wait()
+}
+
+func TestBasePath(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		mount   func(http.Handler) http.Handler
+		index   string
+		post    string
+		want    string
+		options []web.Option
+	}{
+		{"root", func(h http.Handler) http.Handler { return h }, "/", "/Section1", "/", nil},
+		{"strip prefix", func(h http.Handler) http.Handler { return http.StripPrefix("/admin/config", h) }, "/admin/config/", "/admin/config/Section1", "/admin/config/", nil},
+		{"strip prefix with slash", func(h http.Handler) http.Handler { return http.StripPrefix("/admin/config/", h) }, "/admin/config/", "/admin/config/Section1", "/admin/config/", nil},
+		{"empty path", func(h http.Handler) http.Handler { return http.StripPrefix("/admin/config", h) }, "/admin/config", "/admin/config/Section1", "/admin/config/", nil},
+		{"option", func(h http.Handler) http.Handler { return h }, "/", "/Section1", "/proxied/", []web.Option{web.WithBasePath("proxied")}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			handler, err := web.New(&TestConfig{}, tc.options...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			h := tc.mount(handler)
+
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.index, nil))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200 OK, got %d", rr.Code)
+			}
+			body := rr.Body.String()
+			for _, want := range []string{`href="` + tc.want + `assets/css/bulma.min.css"`, `action="` + tc.want + `Section1"`} {
+				if !strings.Contains(body, want) {
+					t.Errorf("expected %s in page", want)
+				}
+			}
+			cookies := rr.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].Path != tc.want {
+				t.Errorf("expected a session cookie for %s, got %v", tc.want, cookies)
+			}
+			m := csrfPattern.FindStringSubmatch(body)
+			if m == nil {
+				t.Fatalf("expected a CSRF token in page")
+			}
+
+			req := httptest.NewRequest(http.MethodPost, tc.post, strings.NewReader("IntField=1&_csrf="+m[1]))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for _, cookie := range cookies {
+				req.AddCookie(cookie)
+			}
+			rr = httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if loc := rr.Header().Get("Location"); rr.Code != http.StatusSeeOther || loc != tc.want {
+				t.Errorf("expected redirect to %s, got %d %s", tc.want, rr.Code, loc)
+			}
+
+			if tc.options == nil {
+				rr = httptest.NewRecorder()
+				h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.want+"assets/css/bulma.min.css", nil))
+				if rr.Code != http.StatusOK {
+					t.Errorf("expected 200 OK for assets, got %d", rr.Code)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkServeIndex(b *testing.B) {
+	cfg := &StoredConfig{}
+	cfg.Server.Labels = map[string]string{"env": "prod", "team": "core"}
+	cfg.Server.Backends = make([]struct {
+		Host string `web:"host"`
+	}, 3)
+	handler, err := web.New(cfg)
+	if err != nil {
+		b.Fatalf("unexpected error: %v", err)
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rr.Code != http.StatusOK {
+			b.Fatalf("expected 200 OK, got %d", rr.Code)
+		}
+	}
+}
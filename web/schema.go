@@ -0,0 +1,265 @@
+package web
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// WithSchema serves the JSON Schema of the config at /api/schema, with the
+// values the config had before it was loaded from the store as defaults.
+// Sections and fields with view roles are left out, so that the schema
+// tells no principal more than it may view.
+func WithSchema() Option {
+	return func(o *configPageOptions) {
+		o.schema = true
+	}
+}
+
+// JSONSchema returns a JSON Schema of the config files written by the file
+// stores and of the JSON API, with the values of config as defaults. Field
+// labels, help texts, choices and validate tags become titles,
+// descriptions, enums and constraints.
+func JSONSchema[T any](config *T) ([]byte, error) {
+	v := reflect.ValueOf(config).Elem()
+	return json.MarshalIndent(configSchema(v, config, schemaOf(v.Type()).Sections), "", "  ")
+}
+
+// configSchema returns the schema of the given sections of the config v.
+// parent is passed to options providers.
+func configSchema(v reflect.Value, parent any, sections []*Node) object {
+	properties := object{}
+	for _, section := range sections {
+		properties = append(properties, member{section.Name, append(object{{"title", section.Label}}, structSchema(section.value(v), section.Fields, parent)...)})
+	}
+	return object{
+		{"$schema", jsonSchemaDialect},
+		{"title", v.Type().Name()},
+		{"type", "object"},
+		{"properties", properties},
+	}
+}
+
+func structSchema(v reflect.Value, fields []*Node, parent any) object {
+	properties := object{}
+	for _, n := range fields {
+		if s := fieldSchema(v, n, parent); s != nil {
+			properties = append(properties, member{n.Name, s})
+		}
+	}
+	return object{{"type", "object"}, {"properties", properties}}
+}
+
+// fieldSchema returns the schema of the field n of the struct owner, or nil
+// if the field is not editable.
+func fieldSchema(owner reflect.Value, n *Node, parent any) object {
+	s := object{{"title", n.Label}}
+	if n.Help != "" {
+		s = append(s, member{"description", n.Help})
+	}
+
+	v := n.value(owner)
+	t := n.Type
+	switch {
+	case n.Kind == StructNode:
+		return append(s, structSchema(v, n.Fields, parent)...)
+	case n.Kind == ListNode:
+		s = append(s, member{"type", "array"}, member{"items", structSchema(reflect.New(t.Elem()).Elem(), n.Fields, parent)})
+	case n.Kind == MapNode:
+		s = append(s, member{"type", "object"}, member{"additionalProperties", scalarSchema(t.Elem())})
+	case t.Kind() == reflect.Slice && isScalarType(t.Elem()):
+		items := scalarSchema(t.Elem())
+		if n.HasOptions() {
+			items = append(items, member{"enum", choiceValues(t.Elem(), n.options(owner, parent))})
+		}
+		s = append(s, member{"type", "array"}, member{"items", items})
+	case isScalarType(t):
+		s = append(s, scalarSchema(t)...)
+		if n.HasOptions() {
+			s = append(s, member{"enum", choiceValues(t, n.options(owner, parent))})
+		}
+	default:
+		return nil
+	}
+
+	s = append(s, ruleSchema(v, n.Rules)...)
+	if !isSettable(n) {
+		s = append(s, member{"readOnly", true})
+	}
+	if n.IsSecret() {
+		return append(s, member{"writeOnly", true})
+	}
+	if value, ok := encodeValue(v, n); ok && isFinite(value) {
+		s = append(s, member{"default", value})
+	}
+	return s
+}
+
+func scalarSchema(t reflect.Type) object {
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return object{{"type", "string"}}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return object{{"type", "boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return object{{"type", "integer"}}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return object{{"type", "integer"}, {"minimum", 0}}
+	case reflect.Float32, reflect.Float64:
+		return object{{"type", "number"}}
+	}
+	return object{{"type", "string"}}
+}
+
+// choiceValues converts the values of choices to the JSON values of the
+// type t, skipping those that do not parse.
+func choiceValues(t reflect.Type, choices []Choice) []any {
+	values := []any{}
+	for _, c := range choices {
+		if value, ok := parseScalar(t, c.Value); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func parseScalar(t reflect.Type, s string) (any, bool) {
+	v := reflect.New(t).Elem()
+	if err := handleField(v, s); err != nil {
+		return nil, false
+	}
+	return encodeScalar(v), true
+}
+
+// ruleSchema returns the constraints equivalent to the validate rules of v.
+// Since rules are skipped for empty text values that are not required,
+// their constraints then also allow the empty string.
+func ruleSchema(v reflect.Value, rules []Rule) object {
+	s := object{}
+	// bounds holds the strictest limit for each keyword.
+	bounds := object{}
+	bound := func(keyword string, limit float64) {
+		for i, m := range bounds {
+			if m.Key == keyword {
+				if strings.HasPrefix(keyword, "min") == (limit > m.Value.(float64)) {
+					bounds[i].Value = limit
+				}
+				return
+			}
+		}
+		bounds = append(bounds, member{keyword, limit})
+	}
+
+	required := false
+	for _, r := range rules {
+		switch r.Name {
+		case "required":
+			required = true
+			switch v.Kind() {
+			case reflect.Bool:
+				s = append(s, member{"const", true})
+			case reflect.String:
+				bound("minLength", 1)
+			case reflect.Slice:
+				bound("minItems", 1)
+			case reflect.Map:
+				bound("minProperties", 1)
+			default:
+				s = append(s, member{"not", object{{"const", encodeScalar(reflect.Zero(v.Type()))}}})
+			}
+		case "min", "max", "len":
+			limit, err := strconv.ParseFloat(r.Arg, 64)
+			if err != nil {
+				continue
+			}
+			for _, keyword := range limitKeywords(v, r.Name) {
+				bound(keyword, limit)
+			}
+		case "pattern":
+			s = append(s, member{"pattern", r.Arg})
+		case "oneof":
+			values := []any{}
+			for _, option := range strings.Fields(r.Arg) {
+				if value, ok := parseScalar(v.Type(), option); ok {
+					values = append(values, value)
+				}
+			}
+			s = append(s, member{"enum", values})
+		case "url":
+			s = append(s, member{"format", "uri"})
+		case "email":
+			s = append(s, member{"format", "email"})
+		}
+	}
+	for _, m := range bounds {
+		s = append(s, member{m.Key, jsonNumber(m.Value.(float64))})
+	}
+
+	if !required && len(s) > 0 && v.Kind() == reflect.String {
+		return object{{"anyOf", []any{object{{"const", ""}}, s}}}
+	}
+	return s
+}
+
+// limitKeywords returns the keywords the min, max or len rule named name
+// sets for v.
+func limitKeywords(v reflect.Value, name string) []string {
+	var suffix string
+	switch v.Kind() {
+	case reflect.String:
+		suffix = "Length"
+	case reflect.Slice:
+		suffix = "Items"
+	case reflect.Map:
+		suffix = "Properties"
+	default:
+		if _, ok := number(v); !ok {
+			return nil
+		}
+		switch name {
+		case "min":
+			return []string{"minimum"}
+		case "max":
+			return []string{"maximum"}
+		}
+		return nil
+	}
+	switch name {
+	case "min":
+		return []string{"min" + suffix}
+	case "max":
+		return []string{"max" + suffix}
+	}
+	return []string{"min" + suffix, "max" + suffix}
+}
+
+// jsonNumber returns f as an integer if it is one, so that it is encoded
+// without a fraction.
+func jsonNumber(f float64) any {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return int64(f)
+	}
+	return f
+}
+
+// isFinite reports whether value, produced by encodeValue, can be encoded
+// as JSON.
+func isFinite(value any) bool {
+	switch v := value.(type) {
+	case float64:
+		return !math.IsNaN(v) && !math.IsInf(v, 0)
+	case []any:
+		return !slices.ContainsFunc(v, func(item any) bool { return !isFinite(item) })
+	case object:
+		return !slices.ContainsFunc(v, func(m member) bool { return !isFinite(m.Value) })
+	case mapping:
+		return isFinite(object(v))
+	}
+	return true
+}
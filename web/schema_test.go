@@ -0,0 +1,108 @@
+package web_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gwangyi/webcfg/web"
+)
+
+// schemaAt returns the schema of the named properties nested in schema.
+func schemaAt(t *testing.T, schema map[string]any, names ...string) map[string]any {
+	t.Helper()
+	for _, name := range names {
+		properties, _ := schema["properties"].(map[string]any)
+		next, ok := properties[name].(map[string]any)
+		if !ok {
+			t.Fatalf("no property %s in %v", name, schema)
+		}
+		schema = next
+	}
+	return schema
+}
+
+func TestJSONSchema(t *testing.T) {
+	data, err := web.JSONSchema(&ChoiceConfig{Section: ChoiceSection{Mode: "active"}, Priorities: []string{"1", "2"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+	if schema["$schema"] != "https://json-schema.org/draft/2020-12/schema" || schema["title"] != "ChoiceConfig" {
+		t.Errorf("unexpected root %v", schema)
+	}
+
+	for _, tc := range []struct {
+		name string
+		want map[string]any
+	}{
+		{"level", map[string]any{"title": "Log Level", "type": "string", "enum": []any{"debug", "info", "error"}, "default": ""}},
+		{"mode", map[string]any{"title": "Mode", "type": "string", "enum": []any{"active", "passive"}, "default": "active"}},
+		{"priority", map[string]any{"title": "Priority", "type": "integer", "enum": []any{1.0, 2.0}, "default": 0.0}},
+		{"regions", map[string]any{"title": "Regions", "type": "array", "items": map[string]any{"type": "string", "enum": []any{"eu", "us", "ap"}}, "default": []any{}}},
+	} {
+		if got := schemaAt(t, schema, "Section", tc.name); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestJSONSchemaRules(t *testing.T) {
+	data, _ := web.JSONSchema(&ValidatedConfig{})
+	var schema map[string]any
+	json.Unmarshal(data, &schema)
+
+	for _, tc := range []struct {
+		name string
+		key  string
+		want any
+	}{
+		{"name", "minLength", 2.0},
+		{"name", "maxLength", 5.0},
+		{"port", "minimum", 1.0},
+		{"port", "maximum", 65535.0},
+		{"agree", "const", true},
+		{"tags", "maxProperties", 1.0},
+		{"servers", "minItems", 1.0},
+		{"code", "anyOf", []any{map[string]any{"const": ""}, map[string]any{"minLength": 3.0, "maxLength": 3.0}}},
+		{"env", "anyOf", []any{map[string]any{"const": ""}, map[string]any{"enum": []any{"dev", "prod"}}}},
+	} {
+		if got := schemaAt(t, schema, "Section", tc.name)[tc.key]; !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s.%s: expected %v, got %v", tc.name, tc.key, tc.want, got)
+		}
+	}
+	host := schemaAt(t, schema, "Section", "servers")["items"].(map[string]any)
+	if got := schemaAt(t, host, "host")["minLength"]; got != 1.0 {
+		t.Errorf("expected required list item field, got %v", got)
+	}
+}
+
+func TestSchemaEndpoint(t *testing.T) {
+	handler, _ := web.New(&NestedConfig{})
+	if rr := apiRequest(handler, http.MethodGet, "/api/schema", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected schema to be disabled by default, got %d", rr.Code)
+	}
+
+	cfg := &NestedConfig{}
+	cfg.Database.Host = "default"
+	handler, _ = web.New(cfg, web.WithSchema())
+	handler.Update(func(cfg *NestedConfig) error {
+		cfg.Database.Host = "changed"
+		return nil
+	})
+	rr := apiRequest(handler, http.MethodGet, "/api/schema", "")
+	var schema map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &schema); err != nil || rr.Header().Get("Content-Type") != "application/schema+json" {
+		t.Fatalf("unexpected response %d %s", rr.Code, rr.Body.String())
+	}
+	if got := schemaAt(t, schema, "Database", "Host")["default"]; got != "default" {
+		t.Errorf("expected initial value as default, got %v", got)
+	}
+	if got := schemaAt(t, schema, "Database", "Pool", "MaxConns")["title"]; got != "Max Connections" {
+		t.Errorf("expected nested field label as title, got %v", got)
+	}
+}
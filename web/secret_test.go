@@ -0,0 +1,201 @@
+package web_test
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gwangyi/webcfg/web"
+)
+
+type SecretReplica struct {
+	Host  string `web:"host"`
+	Token string `web:"token,Token,secret"`
+}
+
+type SecretDatabase struct {
+	Host     string          `web:"host"`
+	Password string          `web:"password,Password,secret"`
+	Replicas []SecretReplica `web:"replicas"`
+}
+
+type SecretConfig struct {
+	Database SecretDatabase
+}
+
+func newSecretConfig() *SecretConfig {
+	return &SecretConfig{Database: SecretDatabase{
+		Host:     "db",
+		Password: "hunter2",
+		Replicas: []SecretReplica{{Host: "r1", Token: "t0ps3cret"}},
+	}}
+}
+
+func TestSecretPage(t *testing.T) {
+	handler, _ := web.New(newSecretConfig())
+	body := (&client{}).get(handler)
+	for _, unwanted := range []string{"hunter2", "t0ps3cret"} {
+		if strings.Contains(body, unwanted) {
+			t.Errorf("expected the page not to contain %s", unwanted)
+		}
+	}
+	for _, wanted := range []string{`name="password" class="input" type="password"`, `name="_clear" value="password"`, `name="_clear" value="replicas.0.token"`, ">set<"} {
+		if !strings.Contains(body, wanted) {
+			t.Errorf("expected the page to contain %s", wanted)
+		}
+	}
+
+	handler, _ = web.New(&SecretConfig{})
+	body = (&client{}).get(handler)
+	if !strings.Contains(body, ">unset<") || strings.Contains(body, `name="_clear" value="password"`) {
+		t.Errorf("expected an unset secret without a clear box")
+	}
+}
+
+type PasswordConfig struct {
+	Login struct {
+		User     string `web:"user"`
+		Password string `web:"password,Password,password"`
+		PIN      int    `web:"pin,PIN,password"`
+	}
+}
+
+func TestPasswordIsSecret(t *testing.T) {
+	cfg := &PasswordConfig{}
+	cfg.Login.User, cfg.Login.Password, cfg.Login.PIN = "alice", "hunter2", 1234
+	handler, _ := web.New(cfg)
+
+	body := (&client{}).get(handler)
+	if strings.Contains(body, "hunter2") || strings.Contains(body, `value="1234"`) || !strings.Contains(body, `name="_clear" value="password"`) {
+		t.Errorf("expected passwords to be rendered as secrets")
+	}
+	rr := apiRequest(handler, http.MethodGet, "/api/sections/Login", "")
+	if body := rr.Body.String(); strings.Contains(body, `"password"`) || strings.Contains(body, `"pin"`) {
+		t.Errorf("expected passwords to be omitted, got %s", body)
+	}
+}
+
+func TestSecretUpdate(t *testing.T) {
+	cfg := newSecretConfig()
+	handler, _ := web.New(cfg)
+	c := &client{}
+
+	c.post(handler, "/Database", url.Values{"host": {"db2"}, "password": {""}, "replicas": {"0"}, "replicas.0.host": {"r2"}, "replicas.0.token": {""}})
+	want := SecretDatabase{Host: "db2", Password: "hunter2", Replicas: []SecretReplica{{Host: "r2", Token: "t0ps3cret"}}}
+	if !reflect.DeepEqual(cfg.Database, want) {
+		t.Fatalf("expected empty secrets to be kept, got %+v", cfg.Database)
+	}
+
+	c.post(handler, "/Database", url.Values{"host": {"db2"}, "password": {"new"}})
+	if cfg.Database.Password != "new" {
+		t.Errorf("expected the password to be set, got %q", cfg.Database.Password)
+	}
+
+	c.post(handler, "/Database", url.Values{"host": {"db2"}, "password": {""}, "_clear": {"password"}})
+	if cfg.Database.Password != "" {
+		t.Errorf("expected the password to be cleared, got %q", cfg.Database.Password)
+	}
+}
+
+func TestSecretAPI(t *testing.T) {
+	cfg := newSecretConfig()
+	handler, _ := web.New(cfg)
+
+	for _, path := range []string{"/api/config", "/api/sections/Database"} {
+		rr := apiRequest(handler, http.MethodGet, path, "")
+		if body := rr.Body.String(); strings.Contains(body, `"password"`) || strings.Contains(body, `"token"`) || !strings.Contains(body, `"host"`) {
+			t.Errorf("expected %s to omit secrets, got %s", path, body)
+		}
+	}
+
+	// A section read from the API can be written back without losing its
+	// secrets.
+	rr := apiRequest(handler, http.MethodGet, "/api/sections/Database", "")
+	put := strings.Replace(rr.Body.String(), `"db"`, `"db2"`, 1)
+	if rr := apiRequest(handler, http.MethodPut, "/api/sections/Database", put); rr.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %s", rr.Code, rr.Body.String())
+	}
+	if cfg.Database.Host != "db2" || cfg.Database.Password != "hunter2" || cfg.Database.Replicas[0].Token != "t0ps3cret" {
+		t.Errorf("unexpected config %+v", cfg.Database)
+	}
+
+	if rr := apiRequest(handler, http.MethodPatch, "/api/sections/Database", `{"password": null}`); rr.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d %s", rr.Code, rr.Body.String())
+	}
+	if cfg.Database.Password != "" || cfg.Database.Host != "db2" {
+		t.Errorf("expected null to clear the password, got %+v", cfg.Database)
+	}
+}
+
+func TestSecretAudit(t *testing.T) {
+	var changes []web.Change
+	cfg := newSecretConfig()
+	handler, _ := web.New(cfg, web.WithAudit(func(c web.Change) { changes = append(changes, c) }))
+
+	apiRequest(handler, http.MethodPatch, "/api/sections/Database", `{"password": "new"}`)
+	apiRequest(handler, http.MethodPatch, "/api/sections/Database", `{"password": null}`)
+	want := [][]web.FieldChange{
+		{{Field: "password", Old: "[redacted]", New: "[redacted]"}},
+		{{Field: "password", Old: "[redacted]", New: ""}},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("expected %d changes, got %+v", len(want), changes)
+	}
+	for i, c := range changes {
+		if !reflect.DeepEqual(c.Fields, want[i]) {
+			t.Errorf("expected %v, got %v", want[i], c.Fields)
+		}
+	}
+}
+
+func TestSecretExports(t *testing.T) {
+	cfg := newSecretConfig()
+
+	schema, err := web.JSONSchema(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(schema), "hunter2") {
+		t.Errorf("expected the schema not to contain the password")
+	}
+	var doc struct {
+		Properties map[string]struct {
+			Properties map[string]map[string]any
+		}
+	}
+	if err := json.Unmarshal(schema, &doc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if password := doc.Properties["Database"].Properties["password"]; password["writeOnly"] != true {
+		t.Errorf("expected the password to be write-only, got %v", password)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	web.BindFlags(fs, cfg)
+	if f := fs.Lookup("database-password"); f == nil || f.DefValue != "" {
+		t.Errorf("expected the flag default of the password to be hidden, got %+v", f)
+	}
+}
+
+func TestSecretMustBeSingleValue(t *testing.T) {
+	type mapConfig struct {
+		Auth struct {
+			Tokens map[string]string `web:"tokens,Tokens,password"`
+		}
+	}
+	type listConfig struct {
+		Auth struct {
+			Keys []string `web:"keys,Keys,secret"`
+		}
+	}
+	if _, err := web.New(&mapConfig{}); err == nil || !strings.Contains(err.Error(), "Auth.tokens") {
+		t.Errorf("expected a password map to be rejected, got %v", err)
+	}
+	if _, err := web.New(&listConfig{}); err == nil || !strings.Contains(err.Error(), "Auth.keys") {
+		t.Errorf("expected a secret list to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	sessionCookieName = "webcfg_session"
+	sessionTTL        = 24 * time.Hour
+	// pruneInterval is how often expired sessions are looked for.
+	pruneInterval = time.Minute
+	// maxSessions caps the sessions kept. The least recently seen session
+	// makes room for a new one.
+	maxSessions   = 10000
+	maxBroadcasts = 16
+)
+
+type session struct {
+	token    string // CSRF token embedded in the forms of the session
+	flashes  []Notification
+	rejected *submission
+	seen     int // sequence number of the last broadcast shown
+	lastSeen time.Time
+}
+
+type broadcast struct {
+	seq int
+	Notification
+}
+
+// sessionStore keeps flash notifications per client, keyed by the session
+// ID stored in a cookie. Broadcast notifications are shown once to every
+// client.
+type sessionStore struct {
+	mu         sync.Mutex
+	sessions   map[string]*session
+	broadcasts []broadcast
+	seq        int
+	now        func() time.Time
+	pruned     time.Time
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: map[string]*session{}, now: time.Now}
+}
+
+func newSessionID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// lookup returns the session ID of the requesting client, or "" if it has
+// none or an unknown or expired one.
+func (s *sessionStore) lookup(r *http.Request) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lookupLocked(r)
+}
+
+// lookupLocked is lookup with s.mu held. Clients send the cookies of every
+// handler mounted along the path of the request, so the first one naming a
+// session of this store is used.
+func (s *sessionStore) lookupLocked(r *http.Request) string {
+	for _, c := range r.CookiesNamed(sessionCookieName) {
+		sess, ok := s.sessions[c.Value]
+		if !ok {
+			continue
+		}
+		now := s.now()
+		if now.Sub(sess.lastSeen) > sessionTTL {
+			delete(s.sessions, c.Value)
+			continue
+		}
+		sess.lastSeen = now
+		return c.Value
+	}
+	return ""
+}
+
+// start returns the session ID of the requesting client, starting a new
+// session and setting its cookie if the client has none. Sessions are only
+// started when there is something to keep for the client, so that clients
+// not using the page do not fill the store. The cookie is scoped to path,
+// the base path of the handler, so that handlers mounted at different paths
+// keep their own sessions.
+func (s *sessionStore) start(w http.ResponseWriter, r *http.Request, path string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id := s.lookupLocked(r); id != "" {
+		return id
+	}
+
+	now := s.now()
+	if now.Sub(s.pruned) >= pruneInterval || len(s.sessions) >= maxSessions {
+		s.prune(now)
+	}
+	if len(s.sessions) >= maxSessions {
+		s.evictOldest()
+	}
+	id := newSessionID()
+	s.sessions[id] = &session{token: newSessionID(), lastSeen: now}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    id,
+		Path:     path,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id
+}
+
+func (s *sessionStore) prune(now time.Time) {
+	s.pruned = now
+	for id, sess := range s.sessions {
+		if now.Sub(sess.lastSeen) > sessionTTL {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// evictOldest removes the least recently seen session.
+func (s *sessionStore) evictOldest() {
+	var oldest string
+	for id, sess := range s.sessions {
+		if oldest == "" || sess.lastSeen.Before(s.sessions[oldest].lastSeen) {
+			oldest = id
+		}
+	}
+	delete(s.sessions, oldest)
+}
+
+// hasBroadcasts reports whether there are broadcasts to show to new
+// sessions.
+func (s *sessionStore) hasBroadcasts() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.broadcasts) > 0
+}
+
+// token returns the CSRF token of the session.
+func (s *sessionStore) token(id string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.sessions[id]; ok {
+		return sess.token
+	}
+	return ""
+}
+
+// validToken reports whether token is the CSRF token of the session.
+func (s *sessionStore) validToken(id, token string) bool {
+	want := s.token(id)
+	return want != "" && subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
+
+func (s *sessionStore) flash(id string, n Notification) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.sessions[id]; ok {
+		sess.flashes = append(sess.flashes, n)
+	}
+}
+
+func (s *sessionStore) broadcast(n Notification) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	s.broadcasts = append(s.broadcasts, broadcast{seq: s.seq, Notification: n})
+	if len(s.broadcasts) > maxBroadcasts {
+		s.broadcasts = s.broadcasts[len(s.broadcasts)-maxBroadcasts:]
+	}
+}
+
+// reject keeps a rejected submission to be rendered back to the session.
+func (s *sessionStore) reject(id string, sub *submission) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.sessions[id]; ok {
+		sess.rejected = sub
+	}
+}
+
+// take returns the broadcasts the session has not seen yet followed by its
+// flash notifications, and its last rejected submission, and clears them.
+func (s *sessionStore) take(id string) ([]Notification, *submission) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+
+	var ns []Notification
+	for _, b := range s.broadcasts {
+		if b.seq > sess.seen {
+			ns = append(ns, b.Notification)
+		}
+	}
+	sess.seen = s.seq
+	ns = append(ns, sess.flashes...)
+	sub := sess.rejected
+	sess.flashes, sess.rejected = nil, nil
+	return ns, sub
+}
+
+// sessionNotifier delivers notifications to a single client.
+type sessionNotifier struct {
+	store *sessionStore
+	id    string
+}
+
+func (n *sessionNotifier) Notify(notification Notification) {
+	n.store.flash(n.id, notification)
+}
@@ -0,0 +1,269 @@
+package web_test
+
+import (
+	"maps"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gwangyi/webcfg/web"
+)
+
+type BroadcastSection struct {
+	Value string
+}
+
+func (s *BroadcastSection) Initialize(parent any, n web.Notifier) error {
+	n.Notify(web.Notification{Message: "Initialized broadcast", Status: "info"})
+	return nil
+}
+
+type BroadcastConfig struct {
+	Section BroadcastSection
+}
+
+type client struct {
+	cookies []*http.Cookie
+	token   string
+}
+
+var csrfPattern = regexp.MustCompile(`name="_csrf" value="([^"]+)"`)
+
+func (c *client) do(handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if cookies := rr.Result().Cookies(); len(cookies) > 0 {
+		c.cookies = cookies
+	}
+	return rr
+}
+
+// get loads the page, keeping the CSRF token of its forms.
+func (c *client) get(handler http.Handler) string {
+	body := c.do(handler, httptest.NewRequest(http.MethodGet, "/", nil)).Body.String()
+	if m := csrfPattern.FindStringSubmatch(body); m != nil {
+		c.token = m[1]
+	}
+	return body
+}
+
+// post submits form with the CSRF token, loading the page first if the
+// client has none.
+func (c *client) post(handler http.Handler, path string, form url.Values) *httptest.ResponseRecorder {
+	if c.token == "" {
+		c.get(handler)
+	}
+	form = maps.Clone(form)
+	if form == nil {
+		form = url.Values{}
+	}
+	form.Set("_csrf", c.token)
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.do(handler, req)
+}
+
+// addCSRF adds the session cookie and CSRF token of a new client of handler
+// to req.
+func addCSRF(handler http.Handler, req *http.Request) {
+	c := &client{}
+	c.get(handler)
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+	req.Header.Set("X-CSRF-Token", c.token)
+}
+
+func TestSessionNotifications(t *testing.T) {
+	cfg := &TestConfig{}
+	handler, _ := web.New(cfg)
+
+	alice, bob := &client{}, &client{}
+	alice.get(handler)
+	bob.get(handler)
+
+	alice.post(handler, "/Section1", url.Values{"IntField": {"invalid"}})
+
+	if body := bob.get(handler); strings.Contains(body, "Update failed") {
+		t.Errorf("expected notification to be delivered only to the submitting client")
+	}
+	if body := alice.get(handler); !strings.Contains(body, "Update failed") {
+		t.Errorf("expected submitting client to see the notification")
+	}
+	if body := alice.get(handler); strings.Contains(body, "Update failed") {
+		t.Errorf("expected notification to be shown only once")
+	}
+}
+
+func TestSessionNotificationsWithoutCookie(t *testing.T) {
+	cfg := &TestConfig{}
+	// Without CSRF protection, a form can be posted before the page is
+	// loaded.
+	handler, _ := web.New(cfg, web.WithoutCSRF())
+
+	c := &client{token: "unused"}
+	rr := c.post(handler, "/Section1", url.Values{"IntField": {"1"}})
+	if len(rr.Result().Cookies()) == 0 {
+		t.Fatalf("expected a session cookie to be set")
+	}
+	if body := c.get(handler); !strings.Contains(body, "Section updated successfully") {
+		t.Errorf("expected notification after redirect")
+	}
+}
+
+func TestSessionsStartedOnDemand(t *testing.T) {
+	handler, _ := web.New(&TestConfig{})
+	noCSRF, _ := web.New(&TestConfig{}, web.WithoutCSRF())
+	withAuth, _ := web.New(&TestConfig{}, web.WithAuth(web.BearerTokens(map[string]string{"token": "bob"})))
+
+	for _, tc := range []struct {
+		name    string
+		handler http.Handler
+		req     *http.Request
+	}{
+		{"API", handler, httptest.NewRequest(http.MethodGet, "/api/config", nil)},
+		{"rejected post", handler, httptest.NewRequest(http.MethodPost, "/Section1", strings.NewReader("IntField=1"))},
+		{"page without CSRF", noCSRF, httptest.NewRequest(http.MethodGet, "/", nil)},
+		{"unauthenticated page", withAuth, httptest.NewRequest(http.MethodGet, "/", nil)},
+		{"unauthenticated post", withAuth, httptest.NewRequest(http.MethodPost, "/Section1", strings.NewReader("IntField=1"))},
+	} {
+		tc.req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		tc.handler.ServeHTTP(rr, tc.req)
+		if cookies := rr.Result().Cookies(); len(cookies) > 0 {
+			t.Errorf("%s: expected no session to be started, got %v", tc.name, cookies)
+		}
+	}
+}
+
+func TestCSRFProtection(t *testing.T) {
+	cfg := &TestConfig{}
+	handler, _ := web.New(cfg)
+
+	alice, mallory := &client{}, &client{}
+	if body := alice.get(handler); alice.token == "" || strings.Count(body, `name="_csrf"`) != 2 {
+		t.Fatalf("expected a CSRF token in every form")
+	}
+	mallory.get(handler)
+
+	for _, tc := range []struct {
+		name  string
+		token string
+	}{
+		{"missing", ""},
+		{"invalid", "invalid"},
+		{"other session", mallory.token},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/Section1", strings.NewReader(url.Values{"IntField": {"1"}, "_csrf": {tc.token}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if rr := alice.do(handler, req); rr.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403 Forbidden, got %d", tc.name, rr.Code)
+		}
+	}
+	if cfg.Section1.IntField != 0 {
+		t.Errorf("expected rejected posts to leave the config untouched")
+	}
+
+	if rr := alice.post(handler, "/Section1", url.Values{"IntField": {"1"}}); rr.Code != http.StatusSeeOther || cfg.Section1.IntField != 1 {
+		t.Errorf("expected post with token to be applied, got %d", rr.Code)
+	}
+}
+
+func TestCSRFExpiredSession(t *testing.T) {
+	cfg := &TestConfig{}
+	handler, _ := web.New(cfg)
+	restarted, _ := web.New(cfg)
+
+	c := &client{}
+	c.get(handler)
+	// The new handler does not know the session of the page.
+	rr := c.post(restarted, "/Section1", url.Values{"IntField": {"1"}})
+	if rr.Code != http.StatusSeeOther || cfg.Section1.IntField != 0 {
+		t.Fatalf("expected a redirect leaving the config untouched, got %d", rr.Code)
+	}
+	if body := c.get(restarted); !strings.Contains(body, "session expired") {
+		t.Errorf("expected a notification that the session expired")
+	}
+	if rr := c.post(restarted, "/Section1", url.Values{"IntField": {"1"}}); rr.Code != http.StatusSeeOther || cfg.Section1.IntField != 1 {
+		t.Errorf("expected the resubmitted form to be applied, got %d", rr.Code)
+	}
+}
+
+func TestWithoutCSRF(t *testing.T) {
+	cfg := &TestConfig{}
+	handler, _ := web.New(cfg, web.WithoutCSRF())
+
+	c := &client{}
+	if body := c.get(handler); strings.Contains(body, `name="_csrf"`) {
+		t.Errorf("expected no CSRF token")
+	}
+	req := httptest.NewRequest(http.MethodPost, "/Section1", strings.NewReader("IntField=1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if rr := c.do(handler, req); rr.Code != http.StatusSeeOther || cfg.Section1.IntField != 1 {
+		t.Errorf("expected post without token to be applied, got %d", rr.Code)
+	}
+}
+
+func TestBroadcastNotifications(t *testing.T) {
+	cfg := &BroadcastConfig{}
+	handler, err := web.New(cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, c := range []*client{{}, {}} {
+		if body := c.get(handler); !strings.Contains(body, "Initialized broadcast") {
+			t.Errorf("expected every client to see the broadcast")
+		}
+		if body := c.get(handler); strings.Contains(body, "Initialized broadcast") {
+			t.Errorf("expected broadcast to be shown once per client")
+		}
+	}
+}
+
+func TestSessionsOfMounts(t *testing.T) {
+	cfgA, cfgB := &TestConfig{}, &TestConfig{}
+	a, _ := web.New(cfgA)
+	b, _ := web.New(cfgB)
+	mux := http.NewServeMux()
+	mux.Handle("/a/", http.StripPrefix("/a", a))
+	mux.Handle("/b/", http.StripPrefix("/b", b))
+	jar, _ := cookiejar.New(nil)
+
+	// The browser sends the cookies of each mount only to it, so loading the
+	// page of b does not replace the session of a.
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		for _, cookie := range jar.Cookies(req.URL) {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		jar.SetCookies(req.URL, rr.Result().Cookies())
+		return rr
+	}
+	tokens := map[string]string{}
+	for _, base := range []string{"/a/", "/b/"} {
+		body := do(httptest.NewRequest(http.MethodGet, "http://example.com"+base, nil)).Body.String()
+		m := csrfPattern.FindStringSubmatch(body)
+		if m == nil {
+			t.Fatalf("expected a CSRF token in the page of %s", base)
+		}
+		tokens[base] = m[1]
+	}
+
+	for base, cfg := range map[string]*TestConfig{"/a/": cfgA, "/b/": cfgB} {
+		form := url.Values{"IntField": {"1"}, "_csrf": {tokens[base]}}
+		req := httptest.NewRequest(http.MethodPost, "http://example.com"+base+"Section1", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if rr := do(req); rr.Code != http.StatusSeeOther || cfg.Section1.IntField != 1 {
+			t.Errorf("expected the update of %s to succeed, got %d %s", base, rr.Code, rr.Body.String())
+		}
+	}
+}
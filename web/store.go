@@ -0,0 +1,124 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// Store persists a config. Load is called by New to fill the config before
+// hooks run, and Save is called after every successful section update.
+type Store[T any] interface {
+	Load(*T) error
+	Save(T) error
+}
+
+// WithStore loads the config from s at startup and saves it after every
+// successful update. s must be a Store of the config type passed to New.
+func WithStore[T any](s Store[T]) Option {
+	return func(o *configPageOptions) {
+		o.store = s
+	}
+}
+
+// writeFileAtomic replaces the file at path with data so that readers see
+// either the old or the new content, keeping the mode of an existing file.
+func writeFileAtomic(path string, data []byte) (err error) {
+	mode := fs.FileMode(0o644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// Persist the rename itself. Not every platform can sync a directory.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// readFile returns the content of the file at path, or nil if it does not
+// exist yet.
+func readFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// JSONFileStore stores the config as a JSON file keyed by section and tag
+// names. A missing file leaves the config as it is.
+type JSONFileStore[T any] struct {
+	path string
+}
+
+func NewJSONFileStore[T any](path string) *JSONFileStore[T] {
+	return &JSONFileStore[T]{path: path}
+}
+
+// Path returns the file the store reads and writes.
+func (s *JSONFileStore[T]) Path() string {
+	return s.path
+}
+
+func (s *JSONFileStore[T]) Load(config *T) error {
+	data, err := readFile(s.path)
+	if err != nil || data == nil {
+		return err
+	}
+
+	var root any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&root); err != nil {
+		return err
+	}
+
+	d := &treeDecoder{}
+	d.decodeConfig(reflect.ValueOf(config).Elem(), root)
+	return d.err()
+}
+
+func (s *JSONFileStore[T]) Save(config T) error {
+	data, err := json.MarshalIndent(encodeConfig(reflect.ValueOf(&config).Elem()), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, append(data, '\n'))
+}
@@ -0,0 +1,307 @@
+package web_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gwangyi/webcfg/web"
+)
+
+type StoredSection struct {
+	Name     string            `web:"name"`
+	Port     int               `web:"port"`
+	Ratio    float64           `web:"ratio"`
+	Enabled  bool              `web:"enabled"`
+	Custom   MyTextUnmarshaler `web:"custom"`
+	Regions  []string          `web:"regions"`
+	Labels   map[string]string `web:"labels"`
+	Pool     PoolConfig        `web:"pool"`
+	Backends []struct {
+		Host string `web:"host"`
+	} `web:"backends"`
+}
+
+type StoredConfig struct {
+	Server StoredSection
+	Other  struct {
+		Value uint `web:"value"`
+	}
+}
+
+type SmallConfig struct {
+	Server StoredSection
+	Small  struct {
+		Level int8  `web:"level"`
+		Count uint8 `web:"count"`
+	}
+}
+
+func TestJSONFileStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	store := web.NewJSONFileStore[StoredConfig](path)
+
+	var cfg StoredConfig
+	cfg.Server = StoredSection{
+		Name:    "server",
+		Port:    8080,
+		Ratio:   0.5,
+		Enabled: true,
+		Custom:  MyTextUnmarshaler{Value: "custom"},
+		Regions: []string{"eu", "us"},
+		Labels:  map[string]string{"b": "2", "a": "1"},
+		Pool:    PoolConfig{MaxConns: 10, MinConns: 1},
+	}
+	cfg.Server.Backends = append(cfg.Server.Backends, struct {
+		Host string `web:"host"`
+	}{Host: "backend"})
+	cfg.Other.Value = 7
+
+	if err := store.Save(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"labels": {
+      "a": "1",
+      "b": "2"
+    }`) {
+		t.Errorf("expected sorted map keys in file, got %s", data)
+	}
+	if strings.Index(string(data), `"name"`) > strings.Index(string(data), `"port"`) {
+		t.Errorf("expected fields in struct order")
+	}
+
+	var loaded StoredConfig
+	if err := store.Load(&loaded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, _ := json.Marshal(loaded)
+	want, _ := json.Marshal(cfg)
+	if string(got) != string(want) {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestJSONFileStoreLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("Missing file", func(t *testing.T) {
+		store := web.NewJSONFileStore[StoredConfig](filepath.Join(dir, "missing.json"))
+		cfg := StoredConfig{}
+		cfg.Server.Name = "default"
+		if err := store.Load(&cfg); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if cfg.Server.Name != "default" {
+			t.Errorf("expected defaults to be kept")
+		}
+	})
+
+	t.Run("Partial file", func(t *testing.T) {
+		path := filepath.Join(dir, "partial.json")
+		os.WriteFile(path, []byte(`{"Server": {"port": 9090, "unknown": 1}}`), 0o644)
+		cfg := StoredConfig{}
+		cfg.Server.Name = "default"
+		if err := web.NewJSONFileStore[StoredConfig](path).Load(&cfg); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if cfg.Server.Name != "default" || cfg.Server.Port != 9090 {
+			t.Errorf("unexpected config: %+v", cfg.Server)
+		}
+	})
+
+	t.Run("Invalid values", func(t *testing.T) {
+		path := filepath.Join(dir, "invalid.json")
+		os.WriteFile(path, []byte(`{"Server": {"port": "abc", "pool": 1, "labels": [], "custom": "error"}}`), 0o644)
+		cfg := StoredConfig{}
+		err := web.NewJSONFileStore[StoredConfig](path).Load(&cfg)
+		var verr *web.ValidationError
+		if !errors.As(err, &verr) || len(verr.Errors) != 4 {
+			t.Fatalf("expected 4 field errors, got %v", err)
+		}
+		if verr.Errors[0].Field != "Server.port" {
+			t.Errorf("unexpected field path %s", verr.Errors[0].Field)
+		}
+	})
+
+	t.Run("Strict values", func(t *testing.T) {
+		path := filepath.Join(dir, "strict.json")
+		os.WriteFile(path, []byte(`{"Server": {"enabled": 1}, "Small": {"level": 300, "count": 256}}`), 0o644)
+		cfg := SmallConfig{}
+		cfg.Server.Enabled = true
+		err := web.NewJSONFileStore[SmallConfig](path).Load(&cfg)
+		var verr *web.ValidationError
+		if !errors.As(err, &verr) || len(verr.Errors) != 3 {
+			t.Fatalf("expected 3 field errors, got %v", err)
+		}
+		if !cfg.Server.Enabled {
+			t.Errorf("expected the rejected boolean to be kept")
+		}
+	})
+
+	t.Run("Invalid JSON", func(t *testing.T) {
+		path := filepath.Join(dir, "syntax.json")
+		os.WriteFile(path, []byte(`{`), 0o644)
+		cfg := StoredConfig{}
+		if err := web.NewJSONFileStore[StoredConfig](path).Load(&cfg); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+}
+
+func TestJSONFileStoreKeepsMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{}`), 0o600)
+	if err := web.NewJSONFileStore[StoredConfig](path).Save(StoredConfig{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Errorf("expected mode 0600, got %v", fi.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected temporary files to be cleaned up, got %d entries", len(entries))
+	}
+}
+
+func TestWithStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"Server": {"name": "from file"}}`), 0o644)
+
+	cfg := &StoredConfig{}
+	handler, err := web.New(cfg, web.WithStore(web.NewJSONFileStore[StoredConfig](path)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Server.Name != "from file" {
+		t.Errorf("expected config to be loaded at startup, got %q", cfg.Server.Name)
+	}
+
+	c := &client{}
+	c.post(handler, "/Other", url.Values{"value": {"42"}})
+
+	reloaded := StoredConfig{}
+	web.NewJSONFileStore[StoredConfig](path).Load(&reloaded)
+	if reloaded.Other.Value != 42 || reloaded.Server.Name != "from file" {
+		t.Errorf("expected update to be saved, got %+v", reloaded)
+	}
+
+	handler.Update(func(c *StoredConfig) error {
+		c.Other.Value = 43
+		return nil
+	})
+	web.NewJSONFileStore[StoredConfig](path).Load(&reloaded)
+	if reloaded.Other.Value != 43 {
+		t.Errorf("expected Update to be saved, got %d", reloaded.Other.Value)
+	}
+}
+
+type failingStore struct {
+	loadErr, saveErr error
+}
+
+func (s *failingStore) Load(*StoredConfig) error { return s.loadErr }
+func (s *failingStore) Save(StoredConfig) error  { return s.saveErr }
+
+func TestWithStoreErrors(t *testing.T) {
+	t.Run("Load error", func(t *testing.T) {
+		_, err := web.New(&StoredConfig{}, web.WithStore[StoredConfig](&failingStore{loadErr: errors.New("load")}))
+		if err == nil {
+			t.Errorf("expected error")
+		}
+	})
+
+	t.Run("Type mismatch", func(t *testing.T) {
+		_, err := web.New(&TestConfig{}, web.WithStore[StoredConfig](&failingStore{}))
+		if err == nil {
+			t.Errorf("expected error")
+		}
+	})
+
+	t.Run("Save error rolls back Update", func(t *testing.T) {
+		cfg := &StoredConfig{}
+		handler, _ := web.New(cfg, web.WithStore[StoredConfig](&failingStore{saveErr: errors.New("disk full")}))
+		err := handler.Update(func(c *StoredConfig) error {
+			c.Other.Value = 42
+			return nil
+		})
+		if err == nil || cfg.Other.Value != 0 {
+			t.Errorf("expected update to be rolled back, got %v and %d", err, cfg.Other.Value)
+		}
+	})
+
+	t.Run("Save error rolls back", func(t *testing.T) {
+		cfg := &StoredConfig{}
+		handler, _ := web.New(cfg, web.WithStore[StoredConfig](&failingStore{saveErr: errors.New("disk full")}))
+		c := &client{}
+		c.post(handler, "/Other", url.Values{"value": {"42"}})
+		if cfg.Other.Value != 0 {
+			t.Errorf("expected update to be rolled back")
+		}
+		if body := c.get(handler); !strings.Contains(body, "disk full") {
+			t.Errorf("expected save error to be reported")
+		}
+	})
+}
+
+type HookedSection struct {
+	Value int `web:"value"`
+	calls *[]int
+}
+
+func (s *HookedSection) Updated(parent any, n web.Notifier) error {
+	*s.calls = append(*s.calls, s.Value)
+	if s.Value < 0 {
+		return errors.New("negative value")
+	}
+	return nil
+}
+
+type HookedConfig struct {
+	Section HookedSection
+}
+
+type countingStore struct {
+	saves   int
+	saveErr error
+}
+
+func (s *countingStore) Load(*HookedConfig) error { return nil }
+
+func (s *countingStore) Save(HookedConfig) error {
+	s.saves++
+	return s.saveErr
+}
+
+func TestUpdateHookBeforeSave(t *testing.T) {
+	t.Run("Rejected update is not saved", func(t *testing.T) {
+		calls := []int{}
+		store := &countingStore{}
+		cfg := &HookedConfig{Section: HookedSection{calls: &calls}}
+		handler, _ := web.New(cfg, web.WithStore[HookedConfig](store))
+		(&client{}).post(handler, "/Section", url.Values{"value": {"-1"}})
+		if store.saves != 0 || cfg.Section.Value != 0 {
+			t.Errorf("expected the rejected update not to be saved, got %d saves", store.saves)
+		}
+	})
+
+	t.Run("Hook sees the rollback of a failed save", func(t *testing.T) {
+		calls := []int{}
+		store := &countingStore{saveErr: errors.New("disk full")}
+		cfg := &HookedConfig{Section: HookedSection{calls: &calls}}
+		handler, _ := web.New(cfg, web.WithStore[HookedConfig](store))
+		(&client{}).post(handler, "/Section", url.Values{"value": {"5"}})
+		if cfg.Section.Value != 0 || len(calls) != 2 || calls[0] != 5 || calls[1] != 0 {
+			t.Errorf("expected the hook to be called with the update and the rollback, got %v", calls)
+		}
+	})
+}
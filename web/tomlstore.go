@@ -0,0 +1,587 @@
+package web
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// TOMLFileStore stores the config as a TOML file with a table per section,
+// keyed by tag names. Saving edits the existing file in place, so comments,
+// key order and keys unknown to the config are preserved. A missing file
+// leaves the config as it is.
+type TOMLFileStore[T any] struct {
+	path string
+}
+
+func NewTOMLFileStore[T any](path string) *TOMLFileStore[T] {
+	return &TOMLFileStore[T]{path: path}
+}
+
+// Path returns the file the store reads and writes.
+func (s *TOMLFileStore[T]) Path() string {
+	return s.path
+}
+
+func (s *TOMLFileStore[T]) Load(config *T) error {
+	data, err := readFile(s.path)
+	if err != nil || data == nil {
+		return err
+	}
+
+	var root map[string]any
+	if err := toml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+
+	d := &treeDecoder{}
+	d.decodeConfig(reflect.ValueOf(config).Elem(), root)
+	return d.err()
+}
+
+func (s *TOMLFileStore[T]) Save(config T) error {
+	data, err := readFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	doc, err := parseTOMLDoc(string(data))
+	if err != nil {
+		return err
+	}
+	tree := encodeConfig(reflect.ValueOf(&config).Elem())
+	if err := checkTOMLRange("", tree); err != nil {
+		return err
+	}
+	doc.mergeObject(doc.root, tree, nil, false)
+	return writeFileAtomic(s.path, []byte(doc.String()))
+}
+
+// tomlDoc is a TOML document split into tables and key/value entries, each
+// keeping its original text and the comment lines before it. It does not
+// validate the document; files are validated when they are loaded.
+type tomlDoc struct {
+	root   *tomlTable
+	tables []*tomlTable
+	tail   []string
+}
+
+type tomlTable struct {
+	lead    []string
+	header  string
+	path    []string
+	array   bool
+	entries []*tomlEntry
+}
+
+type tomlEntry struct {
+	lead   []string
+	prefix string // indentation, key and '=' as written
+	key    []string
+	value  string
+	suffix string // whitespace and comment after the value
+}
+
+func parseTOMLDoc(s string) (*tomlDoc, error) {
+	doc := &tomlDoc{root: &tomlTable{}}
+	current := doc.root
+	var lead []string
+	for i := 0; i < len(s); {
+		end := lineEnd(s, i)
+		line := s[i:end]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			lead = append(lead, line)
+		case strings.HasPrefix(trimmed, "["):
+			start := i + strings.Index(line, "[") + 1
+			array := strings.HasPrefix(trimmed, "[[")
+			if array {
+				start++
+			}
+			path, _, err := parseTOMLKey(s, start, ']')
+			if err != nil {
+				return nil, err
+			}
+			current = &tomlTable{lead: lead, header: line, path: path, array: array}
+			doc.tables = append(doc.tables, current)
+			lead = nil
+		default:
+			key, eq, err := parseTOMLKey(s, i, '=')
+			if err != nil {
+				return nil, err
+			}
+			start := eq + 1
+			for start < len(s) && (s[start] == ' ' || s[start] == '\t') {
+				start++
+			}
+			valueEnd := scanTOMLValue(s, start)
+			value := strings.TrimRight(s[start:valueEnd], " \t\r")
+			end = lineEnd(s, valueEnd)
+			current.entries = append(current.entries, &tomlEntry{
+				lead:   lead,
+				prefix: s[i:start],
+				key:    key,
+				value:  value,
+				suffix: s[start+len(value) : end],
+			})
+			lead = nil
+		}
+		i = end + 1
+	}
+	doc.tail = lead
+	return doc, nil
+}
+
+func lineEnd(s string, i int) int {
+	if j := strings.IndexByte(s[i:], '\n'); j >= 0 {
+		return i + j
+	}
+	return len(s)
+}
+
+// parseTOMLKey parses the dotted key starting at i up to the stop byte and
+// returns its parts and the index of stop.
+func parseTOMLKey(s string, i int, stop byte) ([]string, int, error) {
+	var parts []string
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+			i++
+		}
+		if i >= len(s) {
+			return nil, 0, fmt.Errorf("toml: unterminated key")
+		}
+		switch s[i] {
+		case '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' && s[j] != '\n' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			part, err := strconv.Unquote(s[i : j+1])
+			if err != nil {
+				return nil, 0, fmt.Errorf("toml: invalid key %s", s[i:j+1])
+			}
+			parts = append(parts, part)
+			i = j + 1
+		case '\'':
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				return nil, 0, fmt.Errorf("toml: unterminated key")
+			}
+			parts = append(parts, s[i+1:i+1+j])
+			i += j + 2
+		default:
+			j := i
+			for j < len(s) && isBareKeyChar(s[j]) {
+				j++
+			}
+			if j == i {
+				return nil, 0, fmt.Errorf("toml: invalid key at %q", s[i:lineEnd(s, i)])
+			}
+			parts = append(parts, s[i:j])
+			i = j
+		}
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+			i++
+		}
+		if i < len(s) && s[i] == '.' {
+			i++
+			continue
+		}
+		if i < len(s) && s[i] == stop {
+			return parts, i, nil
+		}
+		return nil, 0, fmt.Errorf("toml: invalid key at %q", s[i:lineEnd(s, i)])
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// scanTOMLValue returns the index just past the value starting at i, which
+// may span several lines if it is a multi-line string, array or table.
+func scanTOMLValue(s string, i int) int {
+	depth := 0
+	for i < len(s) {
+		switch {
+		case strings.HasPrefix(s[i:], `"""`), strings.HasPrefix(s[i:], "'''"):
+			delim := s[i : i+3]
+			j := i + 3
+			for j < len(s) && !strings.HasPrefix(s[j:], delim) {
+				if delim == `"""` && s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			// Up to two quotes may precede the closing delimiter.
+			j += 3
+			for k := 0; k < 2 && j < len(s) && s[j] == delim[0]; k++ {
+				j++
+			}
+			i = j
+			continue
+		case s[i] == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' && s[j] != '\n' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			i = j + 1
+			continue
+		case s[i] == '\'':
+			j := i + 1
+			for j < len(s) && s[j] != '\'' && s[j] != '\n' {
+				j++
+			}
+			i = j + 1
+			continue
+		case s[i] == '[' || s[i] == '{':
+			depth++
+		case s[i] == ']' || s[i] == '}':
+			depth--
+		case s[i] == '#':
+			if depth == 0 {
+				return i
+			}
+			i = lineEnd(s, i)
+			continue
+		case s[i] == '\n':
+			if depth == 0 {
+				return i
+			}
+		}
+		i++
+	}
+	return min(i, len(s))
+}
+
+func (d *tomlDoc) String() string {
+	var b strings.Builder
+	writeLines := func(lines []string) {
+		for _, l := range lines {
+			b.WriteString(l)
+			b.WriteByte('\n')
+		}
+	}
+	writeTable := func(t *tomlTable) {
+		writeLines(t.lead)
+		if t.header != "" {
+			writeLines([]string{t.header})
+		}
+		for _, e := range t.entries {
+			writeLines(e.lead)
+			writeLines([]string{e.prefix + e.value + e.suffix})
+		}
+	}
+	writeTable(d.root)
+	for _, t := range d.tables {
+		writeTable(t)
+	}
+	writeLines(d.tail)
+	return b.String()
+}
+
+// scope returns the range of tables that may hold the subtables of owner.
+// The subtables of an element of an array of tables follow it up to the next
+// table that is not nested in the array.
+func (d *tomlDoc) scope(owner *tomlTable) (int, int) {
+	if owner == nil || !owner.array {
+		return 0, len(d.tables)
+	}
+	start := slices.Index(d.tables, owner) + 1
+	end := start
+	for end < len(d.tables) && len(d.tables[end].path) > len(owner.path) && hasPrefix(d.tables[end].path, owner.path) {
+		end++
+	}
+	return start, end
+}
+
+func hasPrefix(path, prefix []string) bool {
+	return len(path) >= len(prefix) && slices.Equal(path[:len(prefix)], prefix)
+}
+
+// owner returns the array table element the table t is nested in, if any.
+func (d *tomlDoc) owner(t *tomlTable) *tomlTable {
+	if t.array {
+		return t
+	}
+	for i := slices.Index(d.tables, t) - 1; i >= 0; i-- {
+		if d.tables[i].array && hasPrefix(t.path, d.tables[i].path) {
+			return d.tables[i]
+		}
+	}
+	return nil
+}
+
+func (d *tomlDoc) findTables(owner *tomlTable, path []string, array bool) []*tomlTable {
+	var found []*tomlTable
+	start, end := d.scope(owner)
+	for _, t := range d.tables[start:end] {
+		if t.array == array && slices.Equal(t.path, path) {
+			found = append(found, t)
+		}
+	}
+	return found
+}
+
+// insert adds t after the last table within the scope of owner that is
+// nested in the parent of t, or at the end of the scope.
+func (d *tomlDoc) insert(owner *tomlTable, t *tomlTable) {
+	start, end := d.scope(owner)
+	at := end
+	for i := end - 1; i >= start; i-- {
+		if hasPrefix(d.tables[i].path, t.path[:len(t.path)-1]) {
+			at = i + 1
+			break
+		}
+	}
+	if len(d.tables) > 0 || len(d.root.entries) > 0 {
+		t.lead = []string{""}
+	}
+	d.tables = slices.Insert(d.tables, at, t)
+}
+
+// remove deletes the element t of an array of tables with its subtables.
+func (d *tomlDoc) remove(t *tomlTable) {
+	_, end := d.scope(t)
+	d.tables = slices.Delete(d.tables, slices.Index(d.tables, t), end)
+}
+
+func (t *tomlTable) entry(key []string) *tomlEntry {
+	for _, e := range t.entries {
+		if slices.Equal(e.key, key) {
+			return e
+		}
+	}
+	return nil
+}
+
+func (t *tomlTable) hasDotted(prefix []string) bool {
+	for _, e := range t.entries {
+		if len(e.key) > len(prefix) && hasPrefix(e.key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tomlTable) set(key []string, value string) {
+	if e := t.entry(key); e != nil {
+		e.value = value
+		return
+	}
+	indent := ""
+	if n := len(t.entries); n > 0 {
+		p := t.entries[n-1].prefix
+		indent = p[:len(p)-len(strings.TrimLeft(p, " \t"))]
+	}
+	t.entries = append(t.entries, &tomlEntry{prefix: indent + formatTOMLKey(key) + " = ", key: key, value: value})
+}
+
+// mergeObject merges obj into the table t, under the dotted key prefix
+// within it. Keys missing from obj are kept unless it was encoded from a map.
+func (d *tomlDoc) mergeObject(t *tomlTable, obj object, prefix []string, removeMissing bool) {
+	keys := map[string]bool{}
+	for _, m := range obj {
+		keys[m.Key] = true
+		key := append(slices.Clip(prefix), m.Key)
+		path := append(slices.Clip(t.path), key...)
+
+		switch v := m.Value.(type) {
+		case object, mapping:
+			child, _ := members(v)
+			_, childIsMap := v.(mapping)
+			switch {
+			case t.entry(key) != nil:
+				t.set(key, formatTOMLValue(v))
+			case t.hasDotted(key):
+				d.mergeObject(t, child, key, childIsMap)
+				if !t.hasDotted(key) {
+					// Keep the key of an emptied map, so that it does not
+					// load as its default.
+					t.set(key, formatTOMLValue(v))
+				}
+			default:
+				if tables := d.findTables(d.owner(t), path, false); len(tables) > 0 {
+					d.mergeObject(tables[0], child, nil, childIsMap)
+				} else if len(child) > 0 {
+					sub := &tomlTable{header: "[" + formatTOMLKey(path) + "]", path: path}
+					d.insert(d.owner(t), sub)
+					d.mergeObject(sub, child, nil, childIsMap)
+				} else {
+					t.set(key, formatTOMLValue(v))
+				}
+			}
+		case []any:
+			tables := d.findTables(d.owner(t), path, true)
+			if t.entry(key) != nil || len(tables) == 0 && !isObjectList(v) {
+				t.set(key, formatTOMLValue(v))
+				continue
+			}
+			for i, item := range v {
+				if i == len(tables) {
+					elem := &tomlTable{header: "[[" + formatTOMLKey(path) + "]]", path: path, array: true}
+					if i > 0 {
+						// Insert after the previous element and its subtables.
+						_, end := d.scope(tables[i-1])
+						elem.lead = []string{""}
+						d.tables = slices.Insert(d.tables, end, elem)
+					} else {
+						d.insert(d.owner(t), elem)
+					}
+					tables = append(tables, elem)
+				}
+				d.mergeObject(tables[i], item.(object), nil, false)
+			}
+			for _, extra := range tables[len(v):] {
+				d.remove(extra)
+			}
+			if len(v) == 0 {
+				// An emptied array of tables has no table left to show it.
+				t.set(key, formatTOMLValue(v))
+			}
+		default:
+			t.set(key, formatTOMLValue(v))
+		}
+	}
+
+	if removeMissing {
+		t.entries = slices.DeleteFunc(t.entries, func(e *tomlEntry) bool {
+			return len(e.key) == len(prefix)+1 && hasPrefix(e.key, prefix) && !keys[e.key[len(prefix)]]
+		})
+	}
+}
+
+func isObjectList(items []any) bool {
+	if len(items) == 0 {
+		return false
+	}
+	for _, item := range items {
+		if _, ok := item.(object); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func formatTOMLKey(key []string) string {
+	parts := make([]string, len(key))
+	for i, k := range key {
+		parts[i] = k
+		if k == "" || strings.IndexFunc(k, func(r rune) bool { return r > 0x7f || !isBareKeyChar(byte(r)) }) >= 0 {
+			parts[i] = formatTOMLString(k)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func formatTOMLString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// checkTOMLRange returns an error if the tree node, at the dotted path,
+// holds an unsigned integer too large for TOML, whose integers are 64-bit
+// signed.
+func checkTOMLRange(path string, node any) error {
+	switch v := node.(type) {
+	case object:
+		for _, m := range v {
+			if err := checkTOMLRange(path+m.Key+".", m.Value); err != nil {
+				return err
+			}
+		}
+	case mapping:
+		return checkTOMLRange(path, object(v))
+	case []any:
+		for i, item := range v {
+			if err := checkTOMLRange(path+strconv.Itoa(i)+".", item); err != nil {
+				return err
+			}
+		}
+	case uint64:
+		if v > math.MaxInt64 {
+			return fmt.Errorf("%s: %d is out of the range of TOML integers", strings.TrimSuffix(path, "."), v)
+		}
+	}
+	return nil
+}
+
+// formatTOMLValue formats value, a tree produced by encodeConfig, as an
+// inline TOML value.
+func formatTOMLValue(value any) string {
+	switch v := value.(type) {
+	case object, mapping:
+		obj, _ := members(v)
+		if len(obj) == 0 {
+			return "{}"
+		}
+		parts := make([]string, len(obj))
+		for i, m := range obj {
+			parts[i] = formatTOMLKey([]string{m.Key}) + " = " + formatTOMLValue(m.Value)
+		}
+		return "{ " + strings.Join(parts, ", ") + " }"
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = formatTOMLValue(item)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "nan"
+		case math.IsInf(v, 1):
+			return "inf"
+		case math.IsInf(v, -1):
+			return "-inf"
+		}
+		return formatFloat(v)
+	case string:
+		return formatTOMLString(v)
+	}
+	return `""`
+}
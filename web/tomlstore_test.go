@@ -0,0 +1,197 @@
+package web_test
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gwangyi/webcfg/web"
+)
+
+func TestTOMLFileStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	store := web.NewTOMLFileStore[StoredConfig](path)
+
+	var cfg StoredConfig
+	cfg.Server = StoredSection{
+		Name:    "quote \" and\nnewline",
+		Port:    8080,
+		Ratio:   2,
+		Enabled: true,
+		Custom:  MyTextUnmarshaler{Value: "custom"},
+		Regions: []string{"eu", "us"},
+		Labels:  map[string]string{"b": "2", "a.b": "1"},
+		Pool:    PoolConfig{MaxConns: 10, MinConns: 1},
+	}
+	for _, host := range []string{"one", "two"} {
+		cfg.Server.Backends = append(cfg.Server.Backends, struct {
+			Host string `web:"host"`
+		}{Host: host})
+	}
+	cfg.Other.Value = 7
+
+	if err := store.Save(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var loaded StoredConfig
+	if err := store.Load(&loaded); err != nil {
+		data, _ := os.ReadFile(path)
+		t.Fatalf("unexpected error: %v\n%s", err, data)
+	}
+	got, _ := json.Marshal(loaded)
+	want, _ := json.Marshal(cfg)
+	if string(got) != string(want) {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	// Saving again must not change a file it wrote itself.
+	before, _ := os.ReadFile(path)
+	if err := store.Save(loaded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	after, _ := os.ReadFile(path)
+	if string(before) != string(after) {
+		t.Errorf("expected stable output, got:\n%s\nthen:\n%s", before, after)
+	}
+}
+
+func TestTOMLFileStorePreservesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	os.WriteFile(path, []byte(`# Managed by hand
+[Other]
+value = 1
+
+[Server]
+# Listen port
+port = 80 # default
+unknown = "keep"
+pool.MaxConns = 5
+labels = { stale = "x" }
+
+[[Server.backends]]
+host = "a" # first
+extra = true
+
+[[Server.backends]]
+host = "b"
+
+[[Server.backends]]
+host = "c"
+
+[Server.backends.meta]
+gone = true
+`), 0o644)
+	store := web.NewTOMLFileStore[StoredConfig](path)
+
+	var cfg StoredConfig
+	if err := store.Load(&cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Server.Pool.MaxConns != 5 || len(cfg.Server.Backends) != 3 {
+		t.Fatalf("unexpected config: %+v", cfg.Server)
+	}
+	cfg.Server.Port = 9090
+	cfg.Server.Pool.MinConns = 2
+	cfg.Server.Regions = []string{"eu"}
+	cfg.Server.Labels = map[string]string{"env": "prod"}
+	cfg.Server.Backends = cfg.Server.Backends[:2]
+	cfg.Server.Backends[1].Host = "b2"
+	if err := store.Save(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	content := string(data)
+	for _, want := range []string{
+		"# Managed by hand",
+		"# Listen port",
+		"port = 9090 # default",
+		`unknown = "keep"`,
+		"pool.MinConns = 2",
+		`labels = { env = "prod" }`,
+		`host = "a" # first`,
+		"extra = true",
+		`host = "b2"`,
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in file, got:\n%s", want, content)
+		}
+	}
+	for _, unwanted := range []string{"stale", `"c"`, "gone", "[Server.pool]"} {
+		if strings.Contains(content, unwanted) {
+			t.Errorf("expected %q to be removed, got:\n%s", unwanted, content)
+		}
+	}
+
+	var loaded StoredConfig
+	if err := store.Load(&loaded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, _ := json.Marshal(loaded)
+	want, _ := json.Marshal(cfg)
+	if string(got) != string(want) {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestTOMLFileStoreRejectsLargeUnsigned(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	store := web.NewTOMLFileStore[StoredConfig](path)
+
+	var cfg StoredConfig
+	cfg.Other.Value = math.MaxInt64 + 1
+	if err := store.Save(cfg); err == nil || !strings.Contains(err.Error(), "Other.value") {
+		t.Errorf("expected an out of range error, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be written, got %v", err)
+	}
+}
+
+func TestTOMLFileStoreEmptied(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		file string
+	}{
+		{"tables", "[Server]\nport = 80\n\n[Server.labels]\nenv = \"prod\"\n\n[[Server.backends]]\nhost = \"a\"\n"},
+		{"dotted keys", "[Server]\nport = 80\nlabels.env = \"prod\"\n\n[[Server.backends]]\nhost = \"a\"\n"},
+		{"missing keys", "[Server]\nport = 80\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			os.WriteFile(path, []byte(tc.file), 0o644)
+			store := web.NewTOMLFileStore[StoredConfig](path)
+
+			// Defaults that the emptied values must not fall back to.
+			defaults := func() StoredConfig {
+				var cfg StoredConfig
+				cfg.Server.Labels = map[string]string{"env": "dev"}
+				cfg.Server.Backends = append(cfg.Server.Backends, struct {
+					Host string `web:"host"`
+				}{Host: "default"})
+				return cfg
+			}
+			cfg := defaults()
+			if err := store.Load(&cfg); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			cfg.Server.Labels = map[string]string{}
+			cfg.Server.Backends = nil
+			if err := store.Save(cfg); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			loaded := defaults()
+			if err := store.Load(&loaded); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if data, _ := os.ReadFile(path); len(loaded.Server.Labels) != 0 || len(loaded.Server.Backends) != 0 || loaded.Server.Port != 80 {
+				t.Errorf("expected emptied values to stay empty, got %+v from:\n%s", loaded.Server, data)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package web
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// object is a JSON-like object that keeps its members in struct order.
+type object []member
+
+type member struct {
+	Key   string
+	Value any
+}
+
+// mapping is an object encoded from a map. Unlike the fields of a struct,
+// all of its keys are data, so keys missing from it should be removed when
+// it is merged into an existing document.
+type mapping object
+
+func (m mapping) MarshalJSON() ([]byte, error) {
+	return object(m).MarshalJSON()
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(m.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// encodeConfig converts the sections of the config v into a tree of
+// objects, slices and scalars keyed by section and tag names.
+func encodeConfig(v reflect.Value) object {
+	root := object{}
+	for _, section := range schemaOf(v.Type()).Sections {
+		root = append(root, member{section.Name, encodeStruct(section.value(v), section.Fields)})
+	}
+	return root
+}
+
+func encodeStruct(v reflect.Value, fields []*Node) object {
+	obj := object{}
+	for _, n := range fields {
+		if value, ok := encodeValue(n.value(v), n); ok {
+			obj = append(obj, member{n.Name, value})
+		}
+	}
+	return obj
+}
+
+// redactSecrets replaces the values of secret fields in obj, the tree of a
+// struct with the given fields, with the result of redact, or omits them if
+// redact returns false. obj is modified in place and returned.
+func redactSecrets(obj object, fields []*Node, redact func(any) (any, bool)) object {
+	redacted := obj[:0]
+	for _, m := range obj {
+		j := slices.IndexFunc(fields, func(n *Node) bool { return n.Name == m.Key })
+		if j < 0 {
+			redacted = append(redacted, m)
+			continue
+		}
+		switch n := fields[j]; {
+		case n.IsSecret():
+			var ok bool
+			if m.Value, ok = redact(m.Value); !ok {
+				continue
+			}
+		case n.Kind == StructNode:
+			m.Value = redactSecrets(m.Value.(object), n.Fields, redact)
+		case n.Kind == ListNode:
+			items := m.Value.([]any)
+			for i, item := range items {
+				items[i] = redactSecrets(item.(object), n.Fields, redact)
+			}
+		}
+		redacted = append(redacted, m)
+	}
+	return redacted
+}
+
+func encodeValue(v reflect.Value, n *Node) (any, bool) {
+	switch {
+	case n.Kind == StructNode:
+		return encodeStruct(v, n.Fields), true
+	case n.Kind == ListNode:
+		list := make([]any, v.Len())
+		for i := range list {
+			list[i] = encodeStruct(v.Index(i), n.Fields)
+		}
+		return list, true
+	case n.Kind == MapNode:
+		m := mapping{}
+		for _, key := range sortedKeys(v) {
+			m = append(m, member{formatValue(key), encodeScalar(v.MapIndex(key))})
+		}
+		return m, true
+	case v.Kind() == reflect.Slice && isScalarType(v.Type().Elem()):
+		list := make([]any, v.Len())
+		for i := range list {
+			list[i] = encodeScalar(v.Index(i))
+		}
+		return list, true
+	case isScalarType(v.Type()):
+		return encodeScalar(v), true
+	}
+	return nil, false
+}
+
+func encodeScalar(v reflect.Value) any {
+	if _, ok := v.Interface().(encoding.TextMarshaler); ok {
+		return formatValue(v)
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	return v.String()
+}
+
+// treeDecoder sets config values from a tree such as the one produced by
+// encodeConfig or decoded from a file. Keys missing from the tree leave the
+// corresponding values untouched.
+type treeDecoder struct {
+	errs ValidationError
+}
+
+func (d *treeDecoder) fail(path string, err *ParseError) {
+	err.Field = path
+	d.errs.add(&FieldError{Field: path, Code: "parse", Message: fmt.Sprintf("%s: %v", err.Message, err.Err), Err: err})
+}
+
+func (d *treeDecoder) mismatch(path string, node any) {
+	d.fail(path, &ParseError{Message: "invalid value", Err: fmt.Errorf("unexpected %T", node)})
+}
+
+func members(node any) (object, bool) {
+	switch n := node.(type) {
+	case object:
+		return n, true
+	case mapping:
+		return object(n), true
+	case map[string]any:
+		obj := make(object, 0, len(n))
+		for k, v := range n {
+			obj = append(obj, member{k, v})
+		}
+		return obj, true
+	case map[any]any:
+		obj := make(object, 0, len(n))
+		for k, v := range n {
+			obj = append(obj, member{fmt.Sprint(k), v})
+		}
+		return obj, true
+	}
+	return nil, false
+}
+
+func lookup(obj object, key string) (any, bool) {
+	for _, m := range obj {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+	return nil, false
+}
+
+// decodeConfig sets the sections of the config v from root.
+func (d *treeDecoder) decodeConfig(v reflect.Value, root any) {
+	obj, ok := members(root)
+	if !ok {
+		d.mismatch("", root)
+		return
+	}
+	for _, section := range schemaOf(v.Type()).Sections {
+		// A section whose keys are all commented out is null in YAML.
+		if node, ok := lookup(obj, section.Name); ok && node != nil {
+			d.decodeStruct(section.value(v), section.Fields, node, section.Name+".")
+		}
+	}
+}
+
+func (d *treeDecoder) decodeStruct(v reflect.Value, fields []*Node, node any, path string) {
+	obj, ok := members(node)
+	if !ok {
+		d.mismatch(path[:len(path)-1], node)
+		return
+	}
+	for _, n := range fields {
+		if child, ok := lookup(obj, n.Name); ok {
+			d.decodeValue(n.value(v), n, child, path+n.Name)
+		}
+	}
+}
+
+func (d *treeDecoder) decodeValue(v reflect.Value, n *Node, node any, path string) {
+	if node == nil {
+		return
+	}
+	switch {
+	case n.Kind == StructNode:
+		d.decodeStruct(v, n.Fields, node, path+".")
+	case n.Kind == ListNode:
+		items, ok := node.([]any)
+		if !ok {
+			d.mismatch(path, node)
+			return
+		}
+		list := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if i < v.Len() {
+				list.Index(i).Set(v.Index(i))
+			}
+			d.decodeStruct(list.Index(i), n.Fields, item, path+"."+strconv.Itoa(i)+".")
+		}
+		v.Set(list)
+	case n.Kind == MapNode:
+		obj, ok := members(node)
+		if !ok {
+			d.mismatch(path, node)
+			return
+		}
+		t := v.Type()
+		m := reflect.MakeMapWithSize(t, len(obj))
+		for _, mem := range obj {
+			key := reflect.New(t.Key()).Elem()
+			if err := handleField(key, mem.Key); err != nil {
+				d.fail(path, err)
+				continue
+			}
+			value := reflect.New(t.Elem()).Elem()
+			d.decodeScalar(value, mem.Value, path+"."+mem.Key)
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+	case v.Kind() == reflect.Slice && isScalarType(v.Type().Elem()):
+		items, ok := node.([]any)
+		if !ok {
+			d.mismatch(path, node)
+			return
+		}
+		list := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			d.decodeScalar(list.Index(i), item, path+"."+strconv.Itoa(i))
+		}
+		v.Set(list)
+	case isScalarType(v.Type()):
+		d.decodeScalar(v, node, path)
+	}
+}
+
+func (d *treeDecoder) decodeScalar(v reflect.Value, node any, path string) {
+	if node == nil {
+		return
+	}
+	text, ok := scalarText(node)
+	if _, isBool := node.(bool); !ok || v.Kind() == reflect.Bool && !isBool {
+		d.mismatch(path, node)
+		return
+	}
+	if err := setText(v, text); err != nil {
+		d.fail(path, err)
+	}
+}
+
+// scalarText formats a scalar tree node the way it would be typed, so that it
+// is parsed by setText.
+func scalarText(node any) (string, bool) {
+	switch n := node.(type) {
+	case string:
+		return n, true
+	case bool:
+		return strconv.FormatBool(n), true
+	case json.Number:
+		return n.String(), true
+	case float64:
+		return strconv.FormatFloat(n, 'f', -1, 64), true
+	case float32:
+		return strconv.FormatFloat(float64(n), 'f', -1, 32), true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(n), true
+	case encoding.TextMarshaler:
+		b, err := n.MarshalText()
+		return string(b), err == nil
+	}
+	return "", false
+}
+
+// formatFloat formats the finite f so that it reads back as a float rather
+// than an integer in YAML and TOML.
+func formatFloat(f float64) string {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	s := strconv.FormatFloat(f, format, -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+func (d *treeDecoder) err() error {
+	if len(d.errs.Errors) == 0 {
+		return nil
+	}
+	return &d.errs
+}
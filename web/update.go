@@ -5,8 +5,64 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"reflect"
+	"slices"
 	"strconv"
+	"strings"
+)
+
+var textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+
+// newRowKey is the placeholder key of the row template cloned by the page
+// when a row is added to a list.
+const newRowKey = "__new__"
+
+// isNestedType reports whether t is a struct that is edited field by field
+// rather than as a single text value.
+func isNestedType(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+// isListType reports whether t is a slice of structs edited as repeatable
+// rows.
+func isListType(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && isNestedType(t.Elem())
+}
+
+// isScalarType reports whether values of t are edited as a single text value.
+func isScalarType(t reflect.Type) bool {
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// isMapType reports whether t is a map with scalar keys and values edited
+// as key/value rows.
+func isMapType(t reflect.Type) bool {
+	if t.Kind() != reflect.Map {
+		return false
+	}
+	return t.Key().Kind() != reflect.Bool && isScalarType(t.Key()) && isScalarType(t.Elem())
+}
+
+var (
+	ErrDuplicateKey    = errors.New("duplicate key")
+	ErrSectionNotFound = errors.New("section not found")
+	// ErrForbidden is returned for updates of sections and fields that the
+	// principal making them may not edit.
+	ErrForbidden = errors.New("forbidden")
+	// ErrSave is returned for updates that were accepted but could not be
+	// saved to the store, and so were rolled back.
+	ErrSave = errors.New("save config")
 )
 
 type ParseError struct {
@@ -41,7 +97,7 @@ func handleInt(subFieldVal reflect.Value, valStr string) *ParseError {
 	if valStr == "" {
 		valStr = "0"
 	}
-	n, err := strconv.ParseInt(valStr, 10, 64)
+	n, err := strconv.ParseInt(valStr, 10, subFieldVal.Type().Bits())
 	if err != nil {
 		return &ParseError{Message: "invalid integer", Err: err}
 	}
@@ -53,7 +109,7 @@ func handleUint(subFieldVal reflect.Value, valStr string) *ParseError {
 	if valStr == "" {
 		valStr = "0"
 	}
-	n, err := strconv.ParseUint(valStr, 10, 64)
+	n, err := strconv.ParseUint(valStr, 10, subFieldVal.Type().Bits())
 	if err != nil {
 		return &ParseError{Message: "invalid integer", Err: err}
 	}
@@ -73,71 +129,355 @@ func handleFloat(subFieldVal reflect.Value, valStr string) *ParseError {
 	return nil
 }
 
-func handleField(subFieldVal reflect.Value, valStr string) *ParseError {
+func handleText(subFieldVal reflect.Value, valStr string) *ParseError {
+	tu := subFieldVal.Addr().Interface().(encoding.TextUnmarshaler)
+	if err := tu.UnmarshalText([]byte(valStr)); err != nil {
+		return &ParseError{Message: "failed to unmarshal", Err: err}
+	}
+	return nil
+}
+
+func handleString(subFieldVal reflect.Value, valStr string) *ParseError {
+	subFieldVal.SetString(valStr)
+	return nil
+}
+
+func handleNone(reflect.Value, string) *ParseError {
+	return nil
+}
+
+// setter sets a value from its text.
+type setter func(subFieldVal reflect.Value, valStr string) *ParseError
+
+// setterFor returns the setter of values of t. Values of other than scalar
+// types are left untouched.
+func setterFor(t reflect.Type) setter {
 	// Handle boolean/checkbox fields
-	if subFieldVal.Kind() == reflect.Bool {
-		return handleBool(subFieldVal, valStr)
+	if t.Kind() == reflect.Bool {
+		return handleBool
 	}
 
 	// Handle TextUnmarshaler
-	if subFieldVal.CanAddr() {
-		if tu, ok := subFieldVal.Addr().Interface().(encoding.TextUnmarshaler); ok {
-			if err := tu.UnmarshalText([]byte(valStr)); err != nil {
-				return &ParseError{Message: "failed to unmarshal", Err: err}
-			}
-			return nil
-		}
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return handleText
 	}
 
 	// Standard types
-	switch subFieldVal.Kind() {
+	switch t.Kind() {
 	case reflect.String:
-		subFieldVal.SetString(valStr)
+		return handleString
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return handleInt(subFieldVal, valStr)
+		return handleInt
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return handleUint(subFieldVal, valStr)
+		return handleUint
 	case reflect.Float32, reflect.Float64:
-		return handleFloat(subFieldVal, valStr)
+		return handleFloat
 	}
 
-	return nil
+	return handleNone
 }
 
-func (p *configPage[T]) updateConfig(sectionName string, r *http.Request) error {
-	if err := r.ParseForm(); err != nil {
-		return err
+// handleField sets the addressable value subFieldVal from valStr.
+func handleField(subFieldVal reflect.Value, valStr string) *ParseError {
+	return setterFor(subFieldVal.Type())(subFieldVal, valStr)
+}
+
+// formDecoder sets struct fields from submitted form values. Fields are
+// looked up by their form name, which uses the submitted row keys of lists,
+// while errors are recorded by path, which uses the resulting indexes so that
+// they line up with the fields rendered from the decoded value.
+type formDecoder struct {
+	form   url.Values
+	parent any
+	// fixed holds the sources of fields set by overlays, by path. They are
+	// kept, and posting a different value for them fails.
+	fixed map[string]string
+	// partial, if not nil, holds the names of the fields to decode. Other
+	// fields are kept.
+	partial map[string]bool
+	// principal makes the update, and level is what it may do with the
+	// fields being decoded.
+	principal *Principal
+	level     access
+	errs      ValidationError
+	// raw holds the submitted text of fields that failed to parse, by path.
+	raw map[string]string
+}
+
+func newFormDecoder(form url.Values, parent any) *formDecoder {
+	return &formDecoder{form: form, parent: parent, raw: map[string]string{}}
+}
+
+func (d *formDecoder) fail(path string, err *ParseError, raw string) {
+	err.Field = path
+	d.errs.add(&FieldError{Field: path, Code: "parse", Message: fmt.Sprintf("%s: %v", err.Message, err.Err), Err: err})
+	d.raw[path] = raw
+}
+
+// decodeStruct sets the fields of the struct v, descending into nested
+// structs using dotted field names. name and path are the prefixes of the
+// form names and paths of the fields of v.
+func (d *formDecoder) decodeStruct(v reflect.Value, fields []*Node, name, path string) {
+	for _, n := range fields {
+		subFieldVal := n.value(v)
+		fieldName := name + n.Name
+		fieldPath := path + n.Name
+		if source, ok := d.fixed[fieldPath]; ok {
+			if _, ok := d.form[fieldName]; ok && !d.unchanged(v, n, fieldName, fieldPath) {
+				d.errs.add(&FieldError{Field: fieldPath, Code: "overridden", Message: "set by " + source})
+			}
+			continue
+		}
+		partial := d.partial
+		if partial != nil {
+			if !partial[fieldName] && n.Kind != StructNode {
+				continue
+			}
+			// A listed field is decoded as a whole, including the fields of
+			// nested structs and the rows of lists and maps.
+			if partial[fieldName] {
+				d.partial = nil
+			}
+		}
+
+		level := d.level
+		d.level = max(level, n.accessOf(d.principal))
+		switch {
+		case n.Kind == StructNode:
+			d.decodeStruct(subFieldVal, n.Fields, fieldName+".", fieldPath+".")
+		case d.level != editAccess:
+			d.keep(v, n, fieldName, fieldPath)
+		default:
+			d.decodeField(v, n, fieldName, fieldPath)
+		}
+		d.level = level
+		d.partial = partial
 	}
+}
 
-	v := reflect.ValueOf(p.config).Elem()
-	sectionField := v.FieldByName(sectionName)
-	if !sectionField.IsValid() || sectionField.Kind() != reflect.Struct {
-		return fmt.Errorf("section %s not found", sectionName)
+// decodeField sets the field n of the struct v, other than a nested struct.
+func (d *formDecoder) decodeField(v reflect.Value, n *Node, name, path string) {
+	subFieldVal := n.value(v)
+	switch {
+	case n.Kind == ListNode:
+		d.decodeList(subFieldVal, n.Fields, name, path)
+	case n.Kind == MapNode:
+		d.decodeMap(subFieldVal, name, path)
+	case n.HasOptions():
+		if err := handleChoices(subFieldVal, n.options(v, d.parent), n.Input, d.form[name]); err != nil {
+			d.fail(path, err, d.form.Get(name))
+		}
+	case n.IsSecret() && d.form.Get(name) == "":
+		// Secrets are not rendered back, so an empty one is kept unless it
+		// is cleared explicitly.
+		if slices.Contains(d.form[clearField], name) {
+			subFieldVal.SetZero()
+		}
+	default:
+		valStr := d.form.Get(name)
+		if err := n.set(subFieldVal, valStr); err != nil {
+			d.fail(path, err, valStr)
+		}
 	}
+}
 
-	st := sectionField.Type()
-	for i := 0; i < sectionField.NumField(); i++ {
-		subField := st.Field(i)
-		subFieldVal := sectionField.Field(i)
+// keep leaves the field n of the struct v as is, since the principal may
+// not edit it. Posting a value for it fails, unless the principal may view
+// the field and the value is unchanged, as read-only inputs post it.
+func (d *formDecoder) keep(v reflect.Value, n *Node, name, path string) {
+	if _, ok := d.form[name]; !ok {
+		return
+	}
+	if d.level == viewAccess && d.unchanged(v, n, name, path) {
+		return
+	}
+	d.errs.add(&FieldError{Field: path, Code: "forbidden", Message: "not allowed to change", Err: ErrForbidden})
+}
 
-		if subField.PkgPath != "" {
+// unchanged reports whether the value posted for the field n of the struct
+// v equals its current value.
+func (d *formDecoder) unchanged(v reflect.Value, n *Node, name, path string) bool {
+	posted := reflect.New(v.Type()).Elem()
+	posted.Set(v)
+	d.decodeField(posted, n, name, path)
+	before, _ := encodeValue(n.value(v), n)
+	after, _ := encodeValue(n.value(posted), n)
+	return reflect.DeepEqual(before, after)
+}
+
+// decodeList rebuilds the slice v from the row keys posted under name, in
+// the order they were submitted. Rows keyed by an existing index start from
+// the current element so that fields not present in the form are kept.
+func (d *formDecoder) decodeList(v reflect.Value, fields []*Node, name, path string) {
+	keys := d.form[name]
+	list := reflect.MakeSlice(v.Type(), 0, len(keys))
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if key == "" || seen[key] {
 			continue
 		}
+		seen[key] = true
 
-		// Determine field name used in form (default to struct field name, override by tag)
-		field := parseTag(subFieldVal, subField)
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < v.Len() {
+			elem.Set(v.Index(i))
+		}
+		d.decodeStruct(elem, fields, name+"."+key+".", path+"."+strconv.Itoa(list.Len())+".")
+		list = reflect.Append(list, elem)
+	}
+	v.Set(list)
+}
 
-		valStr := r.FormValue(field.Name)
+// decodeMap rebuilds the map v from the key/value rows posted under name.
+// Rows with an empty key are ignored. Since rows are rendered sorted by key,
+// errors are reported against the map itself.
+func (d *formDecoder) decodeMap(v reflect.Value, name, path string) {
+	t := v.Type()
+	m := reflect.MakeMap(t)
+	seen := map[string]bool{}
+	for _, row := range d.form[name] {
+		keyStr := d.form.Get(name + "." + row + ".key")
+		if row == "" || keyStr == "" {
+			continue
+		}
+
+		key := reflect.New(t.Key()).Elem()
+		if err := handleField(key, keyStr); err != nil {
+			d.fail(path, err, "")
+			continue
+		}
+		// Compare the parsed keys, so that e.g. "1" and "01" collide for ints.
+		canonical := fmt.Sprint(key.Interface())
+		if seen[canonical] {
+			d.fail(path, &ParseError{Message: "invalid map", Err: fmt.Errorf("%w %q", ErrDuplicateKey, keyStr)}, "")
+			continue
+		}
+		seen[canonical] = true
 
-		if err := handleField(subFieldVal, valStr); err != nil {
-			err.Field = field.Name
-			return err
+		value := reflect.New(t.Elem()).Elem()
+		if err := handleField(value, d.form.Get(name+"."+row+".value")); err != nil {
+			d.fail(path, err, "")
+			continue
 		}
+		m.SetMapIndex(key, value)
 	}
-	if sectionField.CanAddr() {
-		if ur, ok := sectionField.Addr().Interface().(UpdateReceiver); ok {
-			return ur.Updated(p.config, p)
+	v.Set(m)
+}
+
+// submission is a rejected section update kept to render the submitted
+// values and errors back to the client that made it.
+type submission struct {
+	section string
+	value   reflect.Value
+	raw     map[string]string
+	errs    *ValidationError
+}
+
+// manifestField is the name of the form values listing the fields a form
+// submits. If it is posted, other fields of the section are left untouched.
+const manifestField = "_fields"
+
+// clearField is the name of the form values listing the secret fields to
+// clear.
+const clearField = "_clear"
+
+// updateConfig applies the form posted to the named section. If the values
+// fail to parse or validate, the section is left untouched and the rejected
+// submission is returned along with a *ValidationError.
+func (p *Handler[T]) updateConfig(sectionName string, r *http.Request, n Notifier) (*submission, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	var partial map[string]bool
+	if manifest, ok := r.Form[manifestField]; ok {
+		partial = map[string]bool{}
+		for _, names := range manifest {
+			for name := range strings.SplitSeq(names, ",") {
+				partial[strings.TrimSpace(name)] = true
+			}
+		}
+	}
+	change := Change{Principal: principalFrom(r.Context()), Source: "form"}
+	return p.updateSection(sectionName, r.Form, partial, change, n)
+}
+
+// updateSection decodes form into the named section like a posted form.
+// If partial is not nil, only the fields it names are decoded. change tells
+// who makes the update and how, and is recorded once it is applied.
+func (p *Handler[T]) updateSection(sectionName string, form url.Values, partial map[string]bool, change Change, n Notifier) (*submission, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	section := schemaOf(reflect.TypeFor[T]()).Section(sectionName)
+	if section == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSectionNotFound, sectionName)
+	}
+	if section.accessOf(change.Principal) != editAccess {
+		return nil, fmt.Errorf("%w: %s", ErrForbidden, sectionName)
+	}
+	v := reflect.ValueOf(p.config).Elem()
+	sectionField := section.value(v)
+
+	// Parse into a copy of the whole config so that a failure on any field
+	// leaves the live section untouched, and validators see the config as it
+	// would be after the update.
+	root := reflect.New(v.Type()).Elem()
+	root.Set(v)
+	candidate := section.value(root)
+	d := newFormDecoder(form, p.config)
+	d.fixed = p.sources
+	d.partial = partial
+	d.principal = change.Principal
+	d.decodeStruct(candidate, section.Fields, "", sectionName+".")
+	validateStruct(candidate, section.Fields, sectionName+".", &d.errs, d.raw)
+	if len(d.errs.Errors) == 0 {
+		callValidators(candidate, section.Fields, sectionName+".", root.Addr().Interface(), &d.errs)
+		if cv, ok := root.Addr().Interface().(ConfigValidator); ok {
+			addValidatorError(&d.errs, "", cv.ValidateConfig())
+		}
+	}
+	if len(d.errs.Errors) > 0 {
+		return &submission{section: sectionName, value: candidate, raw: d.raw, errs: &d.errs}, &d.errs
+	}
+
+	previous := reflect.New(candidate.Type()).Elem()
+	previous.Set(sectionField)
+	sectionField.Set(candidate)
+	// The hook may reject the update, so it runs before the update is
+	// saved.
+	ur, _ := sectionField.Addr().Interface().(UpdateReceiver)
+	if ur != nil {
+		if change.Principal != nil {
+			n = &principalNotifier{Notifier: n, principal: change.Principal}
+		}
+		if err := ur.Updated(p.config, n); err != nil {
+			sectionField.Set(previous)
+			return nil, err
 		}
 	}
+	if err := p.save(); err != nil {
+		sectionField.Set(previous)
+		if ur != nil {
+			// Let the hook undo what it did for the update. It accepted
+			// the previous value before, so its error is not expected.
+			ur.Updated(p.config, n)
+		}
+		return nil, err
+	}
+	p.record(change, section, previous)
+	return nil, nil
+}
+
+// save persists the config to the store, if any. The caller must hold the
+// write lock.
+func (p *Handler[T]) save() error {
+	if p.store == nil {
+		return nil
+	}
+	config := *p.config
+	restoreOverlays(reflect.ValueOf(&config).Elem(), p.overlays, p.stored)
+	if err := p.store.Save(config); err != nil {
+		return fmt.Errorf("%w: %w", ErrSave, err)
+	}
 	return nil
 }
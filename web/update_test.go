@@ -45,6 +45,7 @@ func TestUpdateReceiver(t *testing.T) {
 	t.Run("Updated called successfully", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/Section", nil)
 		rr := httptest.NewRecorder()
+		addCSRF(handler, req)
 		handler.ServeHTTP(rr, req)
 
 		if !cfg.Section.UpdatedCalled {
@@ -55,6 +56,7 @@ func TestUpdateReceiver(t *testing.T) {
 	t.Run("Updated returns error", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/ErrSection", nil)
 		rr := httptest.NewRecorder()
+		addCSRF(handler, req)
 		handler.ServeHTTP(rr, req)
 		if rr.Code != http.StatusSeeOther {
 			t.Errorf("expected 303 See Other, got %d", rr.Code)
@@ -64,6 +66,7 @@ func TestUpdateReceiver(t *testing.T) {
 	t.Run("Updated with value receiver", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/ValueSection", nil)
 		rr := httptest.NewRecorder()
+		addCSRF(handler, req)
 		handler.ServeHTTP(rr, req)
 		if rr.Code != http.StatusSeeOther {
 			t.Errorf("expected 303 See Other, got %d", rr.Code)
@@ -93,6 +96,7 @@ func TestPostUpdate(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/Section1", strings.NewReader(form.Encode()))
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		rr := httptest.NewRecorder()
+		addCSRF(handler, req)
 		handler.ServeHTTP(rr, req)
 
 		if rr.Code != http.StatusSeeOther {
@@ -114,6 +118,7 @@ func TestPostUpdate(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/Section1", errReader{})
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		rr := httptest.NewRecorder()
+		addCSRF(handler, req)
 		handler.ServeHTTP(rr, req)
 		if rr.Code != http.StatusSeeOther {
 			t.Errorf("expected 303 See Other, got %d", rr.Code)
@@ -124,6 +129,7 @@ func TestPostUpdate(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/UnknownSection", strings.NewReader(""))
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		rr := httptest.NewRecorder()
+		addCSRF(handler, req)
 		handler.ServeHTTP(rr, req)
 		if rr.Code != http.StatusSeeOther {
 			t.Errorf("expected 303 See Other, got %d", rr.Code)
@@ -136,6 +142,7 @@ func TestPostUpdate(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/Section1", strings.NewReader(form.Encode()))
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		rr := httptest.NewRecorder()
+		addCSRF(handler, req)
 		handler.ServeHTTP(rr, req)
 		if rr.Code != http.StatusSeeOther {
 			t.Errorf("expected 303 See Other, got %d", rr.Code)
@@ -148,6 +155,7 @@ func TestPostUpdate(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/Section1", strings.NewReader(form.Encode()))
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		rr := httptest.NewRecorder()
+		addCSRF(handler, req)
 		handler.ServeHTTP(rr, req)
 		if rr.Code != http.StatusSeeOther {
 			t.Errorf("expected 303 See Other, got %d", rr.Code)
@@ -165,6 +173,7 @@ func TestHandleFieldErrors(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/Section1", strings.NewReader(form.Encode()))
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		rr := httptest.NewRecorder()
+		addCSRF(handler, req)
 		handler.ServeHTTP(rr, req)
 	})
 
@@ -174,6 +183,7 @@ func TestHandleFieldErrors(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/Section1", strings.NewReader(form.Encode()))
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		rr := httptest.NewRecorder()
+		addCSRF(handler, req)
 		handler.ServeHTTP(rr, req)
 	})
 
@@ -183,6 +193,7 @@ func TestHandleFieldErrors(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/Section1", strings.NewReader(form.Encode()))
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		rr := httptest.NewRecorder()
+		addCSRF(handler, req)
 		handler.ServeHTTP(rr, req)
 	})
 
@@ -200,6 +211,7 @@ func TestHandleFieldErrors(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/Section2", strings.NewReader(form.Encode()))
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		rr := httptest.NewRecorder()
+		addCSRF(handler, req)
 		handler.ServeHTTP(rr, req)
 	})
 }
@@ -237,3 +249,271 @@ func TestParseError_As(t *testing.T) {
 		t.Errorf("expected As to return true for ParseError itself")
 	}
 }
+
+type RollbackSection struct {
+	Value string
+	Fail  bool
+}
+
+func (s *RollbackSection) Updated(parent any, n web.Notifier) error {
+	if s.Fail {
+		return errors.New("update error")
+	}
+	return nil
+}
+
+type RollbackConfig struct {
+	Section RollbackSection
+}
+
+func TestUpdateAtomic(t *testing.T) {
+	t.Run("Parse error keeps earlier fields", func(t *testing.T) {
+		cfg := &TestConfig{}
+		cfg.Section1.StringField = "original"
+		handler, _ := web.New(cfg)
+
+		form := url.Values{}
+		form.Add("string_field", "new value")
+		form.Add("IntField", "invalid")
+		req := httptest.NewRequest(http.MethodPost, "/Section1", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		addCSRF(handler, req)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if cfg.Section1.StringField != "original" {
+			t.Errorf("expected 'original', got %s", cfg.Section1.StringField)
+		}
+	})
+
+	t.Run("Updated error restores section", func(t *testing.T) {
+		cfg := &RollbackConfig{Section: RollbackSection{Value: "original"}}
+		handler, _ := web.New(cfg)
+
+		form := url.Values{}
+		form.Add("Value", "new value")
+		form.Add("Fail", "on")
+		req := httptest.NewRequest(http.MethodPost, "/Section", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		addCSRF(handler, req)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if cfg.Section.Value != "original" || cfg.Section.Fail {
+			t.Errorf("expected section to be restored, got %+v", cfg.Section)
+		}
+	})
+}
+
+func TestUpdateNested(t *testing.T) {
+	cfg := &NestedConfig{}
+	handler, _ := web.New(cfg)
+
+	form := url.Values{}
+	form.Add("Host", "db")
+	form.Add("Pool.MaxConns", "20")
+	form.Add("Pool.MinConns", "2")
+	form.Add("TLS.Enabled", "on")
+	form.Add("TLS.Custom", "custom")
+	req := httptest.NewRequest(http.MethodPost, "/Database", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	addCSRF(handler, req)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if cfg.Database.Host != "db" || cfg.Database.Pool.MaxConns != 20 || cfg.Database.Pool.MinConns != 2 {
+		t.Errorf("unexpected config: %+v", cfg.Database)
+	}
+	if !cfg.Database.TLS.Enabled || cfg.Database.TLS.Custom.Value != "custom" {
+		t.Errorf("unexpected TLS config: %+v", cfg.Database.TLS)
+	}
+
+	form.Set("Pool.MinConns", "invalid")
+	req = httptest.NewRequest(http.MethodPost, "/Database", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	addCSRF(handler, req)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if cfg.Database.Pool.MinConns != 2 {
+		t.Errorf("expected nested parse error to leave config untouched, got %d", cfg.Database.Pool.MinConns)
+	}
+}
+
+func TestUpdateList(t *testing.T) {
+	cfg := &ListConfig{}
+	cfg.Proxy.Upstreams = []Upstream{
+		{Host: "a", Weight: 1},
+		{Host: "b", Weight: 2, Rules: []struct{ Path string }{{Path: "/b"}}},
+		{Host: "c", Weight: 3},
+	}
+	handler, _ := web.New(cfg)
+
+	// Move b to the front, remove c and append a new row.
+	form := url.Values{}
+	form.Add("upstreams", "1")
+	form.Add("upstreams", "0")
+	form.Add("upstreams", "n1")
+	form.Add("upstreams.0.host", "a")
+	form.Add("upstreams.0.weight", "1")
+	form.Add("upstreams.1.host", "b")
+	form.Add("upstreams.1.weight", "2")
+	form.Add("upstreams.1.Rules", "0")
+	form.Add("upstreams.1.Rules.0.Path", "/b2")
+	form.Add("upstreams.n1.host", "d")
+	form.Add("upstreams.n1.weight", "4")
+	req := httptest.NewRequest(http.MethodPost, "/Proxy", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	addCSRF(handler, req)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	got := cfg.Proxy.Upstreams
+	if len(got) != 3 || got[0].Host != "b" || got[1].Host != "a" || got[2].Host != "d" || got[2].Weight != 4 {
+		t.Fatalf("unexpected upstreams: %+v", got)
+	}
+	if len(got[0].Rules) != 1 || got[0].Rules[0].Path != "/b2" {
+		t.Errorf("unexpected nested rules: %+v", got[0].Rules)
+	}
+	if cfg.Proxy.updates != 1 {
+		t.Errorf("expected Updated to be called once, got %d", cfg.Proxy.updates)
+	}
+
+	t.Run("Row parse error keeps list", func(t *testing.T) {
+		form := url.Values{}
+		form.Add("upstreams", "0")
+		form.Add("upstreams.0.weight", "invalid")
+		req := httptest.NewRequest(http.MethodPost, "/Proxy", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		addCSRF(handler, req)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if len(cfg.Proxy.Upstreams) != 3 {
+			t.Errorf("expected list to be untouched, got %+v", cfg.Proxy.Upstreams)
+		}
+	})
+
+	t.Run("Empty list", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/Proxy", strings.NewReader(""))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		addCSRF(handler, req)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		if len(cfg.Proxy.Upstreams) != 0 {
+			t.Errorf("expected empty list, got %+v", cfg.Proxy.Upstreams)
+		}
+	})
+}
+
+func TestUpdateMap(t *testing.T) {
+	cfg := &MapConfig{}
+	cfg.Section.Labels = map[string]string{"a": "1"}
+	handler, _ := web.New(cfg)
+
+	form := url.Values{}
+	form.Add("labels", "0")
+	form.Add("labels", "n1")
+	form.Add("labels", "n2")
+	form.Add("labels.0.key", "a")
+	form.Add("labels.0.value", "one")
+	form.Add("labels.n1.key", "b")
+	form.Add("labels.n1.value", "two")
+	form.Add("labels.n2.key", "")
+	form.Add("labels.n2.value", "ignored")
+	form.Add("limits", "0")
+	form.Add("limits.0.key", "7")
+	form.Add("limits.0.value", "70")
+	form.Add("Flags", "0")
+	form.Add("Flags.0.key", "x")
+	form.Add("Flags.0.value", "on")
+	req := httptest.NewRequest(http.MethodPost, "/Section", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	addCSRF(handler, req)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(cfg.Section.Labels) != 2 || cfg.Section.Labels["a"] != "one" || cfg.Section.Labels["b"] != "two" {
+		t.Errorf("unexpected labels: %v", cfg.Section.Labels)
+	}
+	if cfg.Section.Limits[7] != 70 || !cfg.Section.Flags["x"] {
+		t.Errorf("unexpected maps: %v %v", cfg.Section.Limits, cfg.Section.Flags)
+	}
+
+	tests := []struct {
+		name string
+		form url.Values
+	}{
+		{
+			name: "Duplicate key",
+			form: url.Values{"limits": {"0", "1"}, "limits.0.key": {"1"}, "limits.1.key": {"01"}},
+		},
+		{
+			name: "Invalid key",
+			form: url.Values{"limits": {"0"}, "limits.0.key": {"x"}},
+		},
+		{
+			name: "Invalid value",
+			form: url.Values{"limits": {"0"}, "limits.0.key": {"1"}, "limits.0.value": {"x"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &client{}
+			c.post(handler, "/Section", tt.form)
+			if body := c.get(handler); !strings.Contains(body, "Update failed") {
+				t.Errorf("expected update to fail")
+			}
+			if cfg.Section.Limits[7] != 70 {
+				t.Errorf("expected maps to be untouched, got %v", cfg.Section.Limits)
+			}
+		})
+	}
+}
+
+func TestUpdatePartial(t *testing.T) {
+	cfg := &NestedConfig{}
+	cfg.Database.Host = "db"
+	cfg.Database.Pool = PoolConfig{MaxConns: 10, MinConns: 2}
+	cfg.Database.TLS.Enabled = true
+	cfg.Database.TLS.Custom.Value = "custom"
+	handler, _ := web.New(cfg)
+	c := &client{}
+
+	// An unchecked checkbox listed in the manifest is cleared.
+	c.post(handler, "/Database", url.Values{"_fields": {"Pool.MaxConns,TLS.Enabled"}, "Pool.MaxConns": {"20"}})
+	got := handler.Snapshot().Database
+	if got.Host != "db" || got.Pool != (PoolConfig{MaxConns: 20, MinConns: 2}) || got.TLS.Enabled || got.TLS.Custom.Value != "custom" {
+		t.Errorf("expected only listed fields to change, got %+v", got)
+	}
+
+	// A listed nested struct is submitted as a whole.
+	c.post(handler, "/Database", url.Values{"_fields": {"Pool", "Host"}, "Host": {"other"}, "Pool.MaxConns": {"5"}})
+	got = handler.Snapshot().Database
+	if got.Host != "other" || got.Pool != (PoolConfig{MaxConns: 5}) || got.TLS.Custom.Value != "custom" {
+		t.Errorf("expected listed struct to be replaced, got %+v", got)
+	}
+}
+
+func BenchmarkPostUpdate(b *testing.B) {
+	cfg := &TestConfig{}
+	handler, err := web.New(cfg)
+	if err != nil {
+		b.Fatalf("unexpected error: %v", err)
+	}
+	body := url.Values{
+		"string_field": {"value"},
+		"BoolField":    {"on"},
+		"IntField":     {"42"},
+		"uint_field":   {"42"},
+		"float_field":  {"3.14"},
+		"custom_field": {"custom"},
+	}.Encode()
+
+	c := &client{}
+	c.get(handler)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		req := httptest.NewRequest(http.MethodPost, "/Section1", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-CSRF-Token", c.token)
+		rr := c.do(handler, req)
+		if rr.Code != http.StatusSeeOther {
+			b.Fatalf("expected 303 See Other, got %d", rr.Code)
+		}
+	}
+}
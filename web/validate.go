@@ -0,0 +1,317 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FieldError describes a problem with a single field, identified by its
+// dotted path starting with the section name, e.g. Database.pool.max_conns.
+type FieldError struct {
+	Field   string
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError collects every problem found in an update.
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) add(fe *FieldError) {
+	e.Errors = append(e.Errors, fe)
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, fe := range e.Errors {
+		errs[i] = fe
+	}
+	return errs
+}
+
+// messages returns the first message reported for each field.
+func (e *ValidationError) messages() map[string]string {
+	msgs := map[string]string{}
+	for _, fe := range e.Errors {
+		if _, ok := msgs[fe.Field]; !ok {
+			msgs[fe.Field] = fe.Message
+		}
+	}
+	return msgs
+}
+
+// Validator is implemented by sections, or structs nested in them, to check
+// constraints spanning several fields. parent is the candidate config the
+// update would result in. Fields of a *ValidationError or *FieldError
+// returned by Validate are paths relative to the struct, e.g. min_conns;
+// any other error is reported against the struct itself.
+type Validator interface {
+	Validate(parent any) error
+}
+
+// ConfigValidator is implemented by the config type to check constraints
+// spanning sections. Fields of the errors it returns are full paths, e.g.
+// TLS.cert_path.
+type ConfigValidator interface {
+	ValidateConfig() error
+}
+
+// addValidatorError adds the error returned by a validator of the struct at
+// path to errs.
+func addValidatorError(errs *ValidationError, path string, err error) {
+	if err == nil {
+		return
+	}
+	var verr *ValidationError
+	var fe *FieldError
+	switch {
+	case errors.As(err, &verr):
+		for _, fe := range verr.Errors {
+			errs.add(&FieldError{Field: path + fe.Field, Code: fe.Code, Message: fe.Message, Err: fe.Err})
+		}
+	case errors.As(err, &fe):
+		errs.add(&FieldError{Field: path + fe.Field, Code: fe.Code, Message: fe.Message, Err: fe.Err})
+	default:
+		errs.add(&FieldError{Field: strings.TrimSuffix(path, "."), Code: "invalid", Message: err.Error(), Err: err})
+	}
+}
+
+// callValidators calls Validate on the struct v at path and everything
+// nested in it implementing Validator, innermost first.
+func callValidators(v reflect.Value, fields []*Node, path string, parent any, errs *ValidationError) {
+	for _, n := range fields {
+		subFieldVal := n.value(v)
+		fieldPath := path + n.Name
+		switch n.Kind {
+		case StructNode:
+			callValidators(subFieldVal, n.Fields, fieldPath+".", parent, errs)
+		case ListNode:
+			for j := 0; j < subFieldVal.Len(); j++ {
+				callValidators(subFieldVal.Index(j), n.Fields, fieldPath+"."+strconv.Itoa(j)+".", parent, errs)
+			}
+		}
+	}
+
+	if validator, ok := v.Addr().Interface().(Validator); ok {
+		addValidatorError(errs, path, validator.Validate(parent))
+	}
+}
+
+// Rule is a rule of a validate tag, such as min=1.
+type Rule struct {
+	Name string
+	Arg  string
+}
+
+// parseRules splits a validate tag into rules. Since regular expressions may
+// contain commas, a pattern rule extends to the end of the tag.
+func parseRules(tag string) []Rule {
+	var rules []Rule
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "pattern=") {
+			part, tag = tag, ""
+		} else {
+			part, tag, _ = strings.Cut(tag, ",")
+		}
+		name, arg, _ := strings.Cut(part, "=")
+		if name = strings.TrimSpace(name); name != "" {
+			rules = append(rules, Rule{Name: name, Arg: arg})
+		}
+	}
+	return rules
+}
+
+var patterns sync.Map
+
+func compilePattern(expr string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(expr, re)
+	return re, nil
+}
+
+// length returns the length that min, max and len apply to for strings,
+// slices and maps.
+func length(v reflect.Value) (int, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(v.String()), true
+	case reflect.Slice, reflect.Map:
+		return v.Len(), true
+	}
+	return 0, false
+}
+
+func number(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func isEmpty(v reflect.Value) bool {
+	if n, ok := length(v); ok {
+		return n == 0
+	}
+	return v.IsZero()
+}
+
+// checkRule returns a message describing how v violates r, or "" if it
+// does not.
+func checkRule(v reflect.Value, r Rule) string {
+	switch r.Name {
+	case "required":
+		if isEmpty(v) {
+			return "is required"
+		}
+	case "min", "max", "len":
+		limit, err := strconv.ParseFloat(r.Arg, 64)
+		if err != nil {
+			return fmt.Sprintf("has an invalid %s rule %q", r.Name, r.Arg)
+		}
+		return checkLimit(v, r.Name, limit, r.Arg)
+	case "pattern":
+		re, err := compilePattern(r.Arg)
+		if err != nil {
+			return fmt.Sprintf("has an invalid pattern: %v", err)
+		}
+		if !re.MatchString(formatValue(v)) {
+			return fmt.Sprintf("must match %s", r.Arg)
+		}
+	case "oneof":
+		options := strings.Fields(r.Arg)
+		if !slices.Contains(options, formatValue(v)) {
+			return fmt.Sprintf("must be one of %s", strings.Join(options, ", "))
+		}
+	case "url":
+		u, err := url.Parse(formatValue(v))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return "must be a valid URL"
+		}
+	case "email":
+		s := formatValue(v)
+		a, err := mail.ParseAddress(s)
+		if err != nil || a.Address != s {
+			return "must be a valid email address"
+		}
+	case "hostport":
+		_, port, err := net.SplitHostPort(formatValue(v))
+		if err != nil {
+			return "must be a host:port address"
+		}
+		if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 && port != "0" {
+			return "must have a valid port number"
+		}
+	default:
+		return fmt.Sprintf("has an unknown validation rule %q", r.Name)
+	}
+	return ""
+}
+
+func checkLimit(v reflect.Value, name string, limit float64, arg string) string {
+	if n, ok := number(v); ok && name != "len" {
+		if name == "min" && n < limit {
+			return "must be at least " + arg
+		}
+		if name == "max" && n > limit {
+			return "must be at most " + arg
+		}
+		return ""
+	}
+
+	n, ok := length(v)
+	if !ok {
+		return fmt.Sprintf("does not support the %s rule", name)
+	}
+	unit := "items"
+	if v.Kind() == reflect.String {
+		unit = "characters"
+	}
+	switch {
+	case name == "min" && float64(n) < limit:
+		return fmt.Sprintf("must have at least %s %s", arg, unit)
+	case name == "max" && float64(n) > limit:
+		return fmt.Sprintf("must have at most %s %s", arg, unit)
+	case name == "len" && float64(n) != limit:
+		return fmt.Sprintf("must have exactly %s %s", arg, unit)
+	}
+	return ""
+}
+
+// validateValue checks v against rules. Empty text values that are not
+// required skip the remaining rules.
+func validateValue(v reflect.Value, rules []Rule, path string, errs *ValidationError) {
+	if len(rules) == 0 {
+		return
+	}
+	required := slices.ContainsFunc(rules, func(r Rule) bool { return r.Name == "required" })
+	if !required && isScalarType(v.Type()) && v.Kind() != reflect.Bool && formatValue(v) == "" {
+		return
+	}
+	for _, r := range rules {
+		if msg := checkRule(v, r); msg != "" {
+			errs.add(&FieldError{Field: path, Code: r.Name, Message: msg})
+		}
+	}
+}
+
+// validateStruct checks the fields of the struct v and everything nested in
+// it, skipping fields whose path is in failed.
+func validateStruct(v reflect.Value, fields []*Node, path string, errs *ValidationError, failed map[string]string) {
+	for _, n := range fields {
+		subFieldVal := n.value(v)
+		fieldPath := path + n.Name
+		if _, ok := failed[fieldPath]; ok {
+			continue
+		}
+
+		validateValue(subFieldVal, n.Rules, fieldPath, errs)
+		switch n.Kind {
+		case StructNode:
+			validateStruct(subFieldVal, n.Fields, fieldPath+".", errs, failed)
+		case ListNode:
+			for j := 0; j < subFieldVal.Len(); j++ {
+				validateStruct(subFieldVal.Index(j), n.Fields, fieldPath+"."+strconv.Itoa(j)+".", errs, failed)
+			}
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package web_test
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gwangyi/webcfg/web"
+)
+
+type ValidatedSection struct {
+	Name     string            `web:"name" validate:"required,min=2,max=5"`
+	Code     string            `web:"code" validate:"len=3"`
+	Port     int               `web:"port" validate:"min=1,max=65535"`
+	Ratio    float64           `web:"ratio" validate:"max=1"`
+	Slug     string            `web:"slug" validate:"pattern=^[a-z]+(-[a-z]+){0,2}$"`
+	Env      string            `web:"env" validate:"oneof=dev prod"`
+	Homepage string            `web:"homepage" validate:"url"`
+	Email    string            `web:"email" validate:"email"`
+	Listen   string            `web:"listen" validate:"hostport"`
+	Agree    bool              `web:"agree" validate:"required"`
+	Tags     map[string]string `web:"tags" validate:"max=1"`
+	Servers  []struct {
+		Host string `web:"host" validate:"required"`
+	} `web:"servers" validate:"min=1"`
+}
+
+type ValidatedConfig struct {
+	Section ValidatedSection
+}
+
+func validForm() url.Values {
+	return url.Values{
+		"name":           {"abc"},
+		"code":           {"xyz"},
+		"port":           {"8080"},
+		"ratio":          {"0.5"},
+		"slug":           {"a-b"},
+		"env":            {"dev"},
+		"homepage":       {"https://example.com"},
+		"email":          {"me@example.com"},
+		"listen":         {":8080"},
+		"agree":          {"on"},
+		"servers":        {"0"},
+		"servers.0.host": {"a"},
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		value []string
+	}{
+		{"required", "name", []string{""}},
+		{"min length", "name", []string{"a"}},
+		{"max length", "name", []string{"abcdef"}},
+		{"len", "code", []string{"ab"}},
+		{"min number", "port", []string{"0"}},
+		{"max number", "port", []string{"70000"}},
+		{"max float", "ratio", []string{"1.5"}},
+		{"pattern", "slug", []string{"A,B"}},
+		{"oneof", "env", []string{"test"}},
+		{"url", "homepage", []string{"example.com"}},
+		{"email", "email", []string{"Me <me@example.com>"}},
+		{"hostport", "listen", []string{"localhost"}},
+		{"hostport port", "listen", []string{"localhost:http"}},
+		{"required bool", "agree", []string{""}},
+		{"map length", "tags", []string{"0", "1"}},
+		{"list length", "servers", []string{}},
+		{"list row", "servers.0.host", []string{""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &ValidatedConfig{}
+			handler, _ := web.New(cfg)
+
+			form := validForm()
+			form["tags.0.key"] = []string{"a"}
+			form["tags.1.key"] = []string{"b"}
+			form[tt.field] = tt.value
+
+			c := &client{}
+			c.post(handler, "/Section", form)
+			if cfg.Section.Name != "" {
+				t.Errorf("expected section to be left untouched")
+			}
+			if body := c.get(handler); !strings.Contains(body, "Section."+tt.field+": ") {
+				t.Errorf("expected error for %s in body", tt.field)
+			}
+		})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		cfg := &ValidatedConfig{}
+		handler, _ := web.New(cfg)
+		c := &client{}
+		c.post(handler, "/Section", validForm())
+		if cfg.Section.Name != "abc" || cfg.Section.Listen != ":8080" || len(cfg.Section.Servers) != 1 {
+			t.Errorf("unexpected section: %+v", cfg.Section)
+		}
+	})
+
+	t.Run("optional empty", func(t *testing.T) {
+		cfg := &ValidatedConfig{}
+		handler, _ := web.New(cfg)
+		form := validForm()
+		for _, field := range []string{"code", "slug", "env", "homepage", "email", "listen"} {
+			form.Del(field)
+		}
+		c := &client{}
+		c.post(handler, "/Section", form)
+		if cfg.Section.Name != "abc" {
+			t.Errorf("expected empty optional fields to pass validation")
+		}
+	})
+}
+
+func TestValidationInlineErrors(t *testing.T) {
+	cfg := &ValidatedConfig{}
+	handler, _ := web.New(cfg)
+
+	form := validForm()
+	form.Set("name", "a")
+	form.Set("port", "not-a-number")
+	form.Set("servers.0.host", "")
+
+	c := &client{}
+	c.post(handler, "/Section", form)
+	body := c.get(handler)
+
+	for _, want := range []string{
+		`name="name" class="input is-danger" type="text" placeholder="name" value="a"`,
+		`name="port" class="input is-danger" type="text" placeholder="port" value="not-a-number"`,
+		`name="servers.0.host" class="input is-danger"`,
+		`name="code" class="input" type="text" placeholder="code" value="xyz"`,
+		"must have at least 2 characters",
+		"invalid integer",
+		"is required",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in body", want)
+		}
+	}
+
+	if body := c.get(handler); strings.Contains(body, "is-danger\" type=\"text\" placeholder=\"name\"") {
+		t.Errorf("expected rejected values to be shown only once")
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	inner := errors.New("inner")
+	err := &web.ValidationError{Errors: []*web.FieldError{
+		{Field: "Section.a", Code: "required", Message: "is required"},
+		{Field: "Section.b", Code: "parse", Message: "invalid", Err: inner},
+	}}
+	if err.Error() != "Section.a: is required; Section.b: invalid" {
+		t.Errorf("unexpected Error() result: %s", err.Error())
+	}
+	if !errors.Is(err, inner) {
+		t.Errorf("expected Is to find the wrapped error")
+	}
+	var fe *web.FieldError
+	if !errors.As(err, &fe) || fe.Field != "Section.a" {
+		t.Errorf("expected As to find the first field error")
+	}
+}
+
+type PoolSection struct {
+	MinConns int        `web:"min_conns"`
+	MaxConns int        `web:"max_conns"`
+	Limits   PoolLimits `web:"limits"`
+}
+
+type PoolLimits struct {
+	Soft int `web:"soft"`
+	Hard int `web:"hard"`
+}
+
+func (l *PoolLimits) Validate(parent any) error {
+	if l.Hard > 1000 {
+		return errors.New("hard limit exceeds 1000")
+	}
+	return nil
+}
+
+func (s *PoolSection) Validate(parent any) error {
+	if s.MinConns > s.MaxConns {
+		return &web.FieldError{Field: "min_conns", Code: "range", Message: "must not exceed max_conns"}
+	}
+	if s.Limits.Soft > s.Limits.Hard {
+		return errors.New("soft limit exceeds hard limit")
+	}
+	return nil
+}
+
+type TLSSection struct {
+	Enabled bool `web:"enabled"`
+}
+
+type CertSection struct {
+	Path string `web:"path"`
+}
+
+type CrossValidatedConfig struct {
+	Pool PoolSection
+	TLS  TLSSection
+	Cert CertSection
+}
+
+func (c *CrossValidatedConfig) ValidateConfig() error {
+	if c.TLS.Enabled && c.Cert.Path == "" {
+		return &web.ValidationError{Errors: []*web.FieldError{
+			{Field: "Cert.path", Code: "required", Message: "is required when TLS is enabled"},
+		}}
+	}
+	return nil
+}
+
+func TestValidators(t *testing.T) {
+	cfg := &CrossValidatedConfig{}
+	handler, _ := web.New(cfg)
+
+	t.Run("Section field error", func(t *testing.T) {
+		c := &client{}
+		c.post(handler, "/Pool", url.Values{"min_conns": {"5"}, "max_conns": {"1"}})
+		if cfg.Pool.MinConns != 0 {
+			t.Errorf("expected section to be left untouched")
+		}
+		body := c.get(handler)
+		if !strings.Contains(body, `name="min_conns" class="input is-danger" type="text" placeholder="min_conns" value="5"`) {
+			t.Errorf("expected inline error on min_conns")
+		}
+		if !strings.Contains(body, "must not exceed max_conns") {
+			t.Errorf("expected validator message")
+		}
+	})
+
+	t.Run("Section error", func(t *testing.T) {
+		c := &client{}
+		c.post(handler, "/Pool", url.Values{"limits.soft": {"5"}, "limits.hard": {"1"}})
+		body := c.get(handler)
+		if !strings.Contains(body, `<p class="help is-danger">soft limit exceeds hard limit</p>`) {
+			t.Errorf("expected section level error")
+		}
+	})
+
+	t.Run("Nested struct error", func(t *testing.T) {
+		c := &client{}
+		c.post(handler, "/Pool", url.Values{"limits.hard": {"2000"}})
+		body := c.get(handler)
+		if !strings.Contains(body, `<p class="help is-danger">hard limit exceeds 1000</p>`) {
+			t.Errorf("expected error of the nested struct")
+		}
+	})
+
+	t.Run("Config error in another section", func(t *testing.T) {
+		c := &client{}
+		c.post(handler, "/TLS", url.Values{"enabled": {"on"}})
+		if cfg.TLS.Enabled {
+			t.Errorf("expected section to be left untouched")
+		}
+		body := c.get(handler)
+		if !strings.Contains(body, `name="path" class="input is-danger"`) || !strings.Contains(body, "is required when TLS is enabled") {
+			t.Errorf("expected inline error on Cert.path")
+		}
+	})
+
+	t.Run("Valid", func(t *testing.T) {
+		c := &client{}
+		c.post(handler, "/Cert", url.Values{"path": {"/cert.pem"}})
+		c.post(handler, "/TLS", url.Values{"enabled": {"on"}})
+		c.post(handler, "/Pool", url.Values{"min_conns": {"1"}, "max_conns": {"5"}, "limits.soft": {"1"}, "limits.hard": {"2"}})
+		if !cfg.TLS.Enabled || cfg.Pool.MaxConns != 5 {
+			t.Errorf("unexpected config: %+v", cfg)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package web
 
 import (
+	"cmp"
 	"embed"
 	"encoding"
 	"fmt"
@@ -9,6 +10,9 @@ import (
 	"io/fs"
 	"net/http"
 	"reflect"
+	"slices"
+	"strconv"
+	"sync"
 )
 
 //go:embed templates/index.html.tmpl
@@ -21,66 +25,212 @@ var assetsFS embed.FS
 
 var embeddedAssetsHandler = http.FileServer(http.FS(assetsFS))
 
+// indexTemplate returns the page template, parsed from indexTmplFS on
+// first use.
+var indexTemplate = sync.OnceValues(parseIndexTemplate)
+
+func parseIndexTemplate() (*template.Template, error) {
+	return template.ParseFS(indexTmplFS, "templates/index.html.tmpl")
+}
+
 func (p *Page) writeIndex(w io.Writer) error {
-	tmpl, err := template.ParseFS(indexTmplFS, "templates/index.html.tmpl")
+	tmpl, err := indexTemplate()
 	if err != nil {
 		return err
 	}
 	return tmpl.Execute(w, p)
 }
 
-func (p *configPage[T]) buildPage() {
-	v := reflect.ValueOf(p.config).Elem()
-	t := v.Type()
+// buildPage renders the current config as principal may view it. If sub is
+// not nil, its section is rendered from the rejected value with the
+// submitted text of fields that failed to parse, and its errors are shown
+// next to the fields.
+func (p *Handler[T]) buildPage(sub *submission, principal *Principal) *Page {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 
-	p.Title = t.Name()
-	p.Sections = nil
-	for i := 0; i < v.NumField(); i++ {
-		field := t.Field(i)
-		fieldVal := v.Field(i)
+	v := reflect.ValueOf(p.config).Elem()
+	schema := schemaOf(reflect.TypeFor[T]())
 
-		// Only process exported fields that are structs (Sections)
-		if field.PkgPath != "" || fieldVal.Kind() != reflect.Struct {
+	page := &Page{Title: schema.Type.Name()}
+	for _, n := range schema.Sections {
+		if n = n.restrict(principal, false); n == nil {
 			continue
 		}
+		fieldVal := n.value(v)
+		if sub != nil && sub.section == n.Name {
+			fieldVal = sub.value
+		}
+		section := buildSection(fieldVal, n, p.config)
+		applySources(&section, section.Action+".", p.sources)
+		if sub != nil {
+			msgs := sub.errs.messages()
+			applySubmission(&section, section.Action+".", sub, msgs)
+			section.Help = msgs[section.Action]
+		}
+		page.Sections = append(page.Sections, section)
+	}
+	page.HasAssets = p.assetsHandler != nil
+	return page
+}
 
-		p.Sections = append(p.Sections, buildSection(fieldVal, field))
+// applySubmission marks the fields of section that have errors in sub and
+// restores their submitted text. prefix is the path prefix of the section.
+func applySubmission(section *Section, prefix string, sub *submission, msgs map[string]string) {
+	for i := range section.Fields {
+		f := &section.Fields[i]
+		path := prefix + f.Name
+		if raw, ok := sub.raw[path]; ok && f.Type != "secret" {
+			f.Value = raw
+		}
+		if msg, ok := msgs[path]; ok {
+			f.Status = "danger"
+			f.Help = msg
+		}
+	}
+	for i := range section.Subsections {
+		s := &section.Subsections[i]
+		s.Help = msgs[prefix+s.Name]
+		applySubmission(s, prefix, sub, msgs)
+	}
+	for i := range section.Lists {
+		l := &section.Lists[i]
+		if msg, ok := msgs[prefix+l.Name]; ok {
+			l.Help = msg
+		}
+		for j := range l.Rows {
+			applySubmission(&l.Rows[j].Section, prefix, sub, msgs)
+		}
 	}
-	p.HasAssets = p.assetsHandler != nil
 }
 
-func buildSection(v reflect.Value, f reflect.StructField) Section {
+func buildSection(v reflect.Value, n *Node, parent any) Section {
 	section := Section{
-		Title:  f.Name,
-		Action: f.Name,
+		Title:    n.Label,
+		Action:   n.Name,
+		Readonly: n.readonly,
 	}
+	buildFields(&section, v, n.Fields, "", parent)
+	return section
+}
 
-	st := v.Type()
-	for i := 0; i < v.NumField(); i++ {
-		subField := st.Field(i)
-		subFieldVal := v.Field(i)
-
-		if subField.PkgPath != "" {
-			continue
+// buildFields appends the fields of the struct v to section. Nested structs
+// become subsections whose field names are prefixed with their dotted path.
+func buildFields(section *Section, v reflect.Value, fields []*Node, prefix string, parent any) {
+	for _, n := range fields {
+		subFieldVal := n.value(v)
+		switch n.Kind {
+		case StructNode:
+			sub := Section{Title: n.Label, Name: prefix + n.Name}
+			buildFields(&sub, subFieldVal, n.Fields, prefix+n.Name+".", parent)
+			section.Subsections = append(section.Subsections, sub)
+		case ListNode:
+			section.Lists = append(section.Lists, buildList(subFieldVal, n, prefix+n.Name, parent))
+		case MapNode:
+			section.Lists = append(section.Lists, buildMap(subFieldVal, n, prefix+n.Name))
+		default:
+			f := buildField(subFieldVal, n)
+			f.Readonly = n.readonly
+			if n.HasOptions() {
+				f.Options = buildChoices(n.options(v, parent), subFieldVal)
+			}
+			f.Name = prefix + f.Name
+			section.Fields = append(section.Fields, f)
 		}
+	}
+}
 
-		section.Fields = append(section.Fields, buildField(subFieldVal, subField))
+func buildList(v reflect.Value, n *Node, name string, parent any) List {
+	list := List{Title: n.Label, Name: name, Readonly: n.readonly}
+	for i := 0; i < v.Len(); i++ {
+		list.Rows = append(list.Rows, buildRow(v.Index(i), n, name, strconv.Itoa(i), parent))
 	}
+	list.Template = buildRow(reflect.New(n.Type.Elem()).Elem(), n, name, newRowKey, parent)
+	return list
+}
 
-	return section
+func buildRow(v reflect.Value, n *Node, list, key string, parent any) Row {
+	row := Row{List: list, Key: key, Sortable: true}
+	row.Readonly = n.readonly
+	buildFields(&row.Section, v, n.Fields, list+"."+key+".", parent)
+	return row
+}
+
+// buildMap renders the map v as key/value rows sorted by key.
+func buildMap(v reflect.Value, n *Node, name string) List {
+	list := List{Title: n.Label, Name: name, Readonly: n.readonly}
+	for i, key := range sortedKeys(v) {
+		list.Rows = append(list.Rows, buildMapRow(key, v.MapIndex(key), n, name, strconv.Itoa(i)))
+	}
+	list.Template = buildMapRow(reflect.Zero(n.Type.Key()), reflect.Zero(n.Type.Elem()), n, name, newRowKey)
+	return list
 }
 
-func buildField(v reflect.Value, sf reflect.StructField) Field {
-	f := parseTag(v, sf)
+func buildMapRow(key, value reflect.Value, n *Node, list, row string) Row {
+	prefix := list + "." + row + "."
+	keyField := Field{Name: prefix + "key", Label: "Key", Type: "text", Readonly: n.readonly}
+	valueField := Field{Name: prefix + "value", Label: "Value", Type: n.Input, Icon: n.Icon, Readonly: n.readonly}
+	// Leave the key of a new row blank so an untouched row is ignored.
+	if row != newRowKey {
+		keyField.Value = formatValue(key)
+	}
+	if value.Kind() == reflect.Bool {
+		valueField.Type = "checkbox"
+	}
+	valueField.Value = formatValue(value)
+
+	r := Row{List: list, Key: row}
+	r.Readonly = n.readonly
+	r.Fields = []Field{keyField, valueField}
+	return r
+}
+
+// sortedKeys returns the keys of the map v in ascending order.
+func sortedKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	slices.SortFunc(keys, func(a, b reflect.Value) int {
+		switch a.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return cmp.Compare(a.Int(), b.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return cmp.Compare(a.Uint(), b.Uint())
+		case reflect.Float32, reflect.Float64:
+			return cmp.Compare(a.Float(), b.Float())
+		}
+		return cmp.Compare(formatValue(a), formatValue(b))
+	})
+	return keys
+}
 
-	// Get Value
+func buildField(v reflect.Value, n *Node) Field {
+	f := n.tag()
+	if n.IsSecret() {
+		f.Set = !v.IsZero()
+		return f
+	}
+	f.Value = formatValue(v)
+	return f
+}
+
+// buildChoices marks the choices matching the current value of v, or each
+// of its elements for multiselect fields, as selected.
+func buildChoices(choices []Choice, v reflect.Value) []Choice {
+	if v.Kind() != reflect.Slice {
+		return selectChoices(choices, formatValue(v))
+	}
+	values := make([]string, v.Len())
+	for i := range values {
+		values[i] = formatValue(v.Index(i))
+	}
+	return selectChoices(choices, values...)
+}
+
+func formatValue(v reflect.Value) string {
 	if tm, ok := v.Interface().(encoding.TextMarshaler); ok {
 		if b, err := tm.MarshalText(); err == nil {
-			f.Value = string(b)
+			return string(b)
 		}
-	} else {
-		f.Value = fmt.Sprint(v.Interface())
+		return ""
 	}
-
-	return f
+	return fmt.Sprint(v.Interface())
 }
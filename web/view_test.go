@@ -127,3 +127,124 @@ func TestServeCustomCSSWithOption(t *testing.T) {
 		t.Errorf("expected custom primary color HSL in CSS")
 	}
 }
+
+type PoolConfig struct {
+	MaxConns int `web:"MaxConns,Max Connections"`
+	MinConns int
+}
+
+type NestedDatabaseConfig struct {
+	Host string
+	Pool PoolConfig `web:",Connection Pool"`
+	TLS  struct {
+		Enabled bool
+		Custom  MyTextUnmarshaler
+	}
+}
+
+type NestedConfig struct {
+	Database NestedDatabaseConfig
+}
+
+func TestNestedSections(t *testing.T) {
+	cfg := &NestedConfig{}
+	cfg.Database.Pool.MaxConns = 10
+	handler, _ := web.New(cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	for _, want := range []string{`name="Pool.MaxConns"`, `value="10"`, `name="TLS.Enabled"`, `name="TLS.Custom"`, "Connection Pool"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in body", want)
+		}
+	}
+}
+
+type Upstream struct {
+	Host   string `web:"host,Host"`
+	Weight int    `web:"weight,Weight"`
+	Rules  []struct {
+		Path string
+	}
+}
+
+type ListSection struct {
+	Name      string
+	Upstreams []Upstream `web:"upstreams,Upstream Servers"`
+	updates   int
+}
+
+func (s *ListSection) Updated(parent any, n web.Notifier) error {
+	s.updates++
+	return nil
+}
+
+type ListConfig struct {
+	Proxy ListSection
+}
+
+func TestListRendering(t *testing.T) {
+	cfg := &ListConfig{}
+	cfg.Proxy.Upstreams = []Upstream{{Host: "a", Weight: 1}, {Host: "b", Weight: 2}}
+	handler, _ := web.New(cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	for _, want := range []string{
+		`data-list="upstreams"`,
+		`name="upstreams" value="0"`,
+		`name="upstreams" value="1"`,
+		`name="upstreams.1.host"`,
+		`name="upstreams.__new__.host"`,
+		`data-list="upstreams.0.Rules"`,
+		"Upstream Servers",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in body", want)
+		}
+	}
+}
+
+type MapSection struct {
+	Labels map[string]string `web:"labels,Labels"`
+	Limits map[int]int       `web:"limits,Limits,number"`
+	Flags  map[string]bool
+}
+
+type MapConfig struct {
+	Section MapSection
+}
+
+func TestMapRendering(t *testing.T) {
+	cfg := &MapConfig{}
+	cfg.Section.Labels = map[string]string{"b": "2", "a": "1", "c": "3"}
+	cfg.Section.Limits = map[int]int{10: 1, 9: 2}
+	handler, _ := web.New(cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	a := strings.Index(body, `name="labels.0.key" class="input" type="text" placeholder="Key" value="a"`)
+	b := strings.Index(body, `name="labels.1.key" class="input" type="text" placeholder="Key" value="b"`)
+	c := strings.Index(body, `name="labels.2.key" class="input" type="text" placeholder="Key" value="c"`)
+	if a < 0 || b < a || c < b {
+		t.Errorf("expected labels to be rendered in sorted order")
+	}
+	if !strings.Contains(body, `name="limits.0.key" class="input" type="text" placeholder="Key" value="9"`) {
+		t.Errorf("expected integer keys to be sorted numerically")
+	}
+	if !strings.Contains(body, `name="limits.0.value" class="input" type="number"`) {
+		t.Errorf("expected tag type to apply to values")
+	}
+	if !strings.Contains(body, `name="labels.__new__.key" class="input" type="text" placeholder="Key" value=""`) {
+		t.Errorf("expected blank key in row template")
+	}
+}
@@ -0,0 +1,162 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithWatch polls the file behind the store every interval and reloads the
+// config when the file changes. The store must have a Path method, as the
+// built-in file stores do. Call Handler.Close to stop watching.
+func WithWatch(interval time.Duration) Option {
+	return func(o *configPageOptions) {
+		o.watch = interval
+	}
+}
+
+type pathStore interface {
+	Path() string
+}
+
+type watcher struct {
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) (fileStamp, error) {
+	fi, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fileStamp{}, nil
+	} else if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: fi.ModTime(), size: fi.Size()}, nil
+}
+
+func (p *Handler[T]) watch(path string, interval time.Duration) {
+	w := &watcher{stop: make(chan struct{}), done: make(chan struct{})}
+	p.watcher = w
+	last, _ := statFile(path)
+
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+			}
+			stamp, err := statFile(path)
+			if err != nil || stamp == last {
+				continue
+			}
+			last = stamp
+			changed, err := p.reload()
+			if err != nil {
+				p.Notify(Notification{Message: "Reloading " + path + " failed: " + err.Error(), Status: "danger"})
+			} else if len(changed) > 0 {
+				p.Notify(Notification{Message: "Reloaded " + strings.Join(changed, ", ") + " from " + path, Status: "info"})
+			}
+		}
+	}()
+}
+
+// Close stops watching the backing file, if WithWatch was given.
+func (p *Handler[T]) Close() error {
+	if w := p.watcher; w != nil {
+		w.once.Do(func() { close(w.stop) })
+		<-w.done
+	}
+	return nil
+}
+
+// reload loads the store into a copy of the config and, if it validates,
+// commits it and calls the UpdateReceiver of every section that changed.
+// It returns the names of the changed sections.
+func (p *Handler[T]) reload() ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	v := reflect.ValueOf(p.config).Elem()
+	root := reflect.New(v.Type()).Elem()
+	root.Set(v)
+	// Load into the stored values, so that keys missing from the file keep
+	// them rather than the values of the overlays.
+	restoreOverlays(root, p.overlays, p.stored)
+	if err := p.store.Load(root.Addr().Interface().(*T)); err != nil {
+		return nil, err
+	}
+	stored, err := applyOverlays(root, p.overlays)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []*Node
+	var errs ValidationError
+	for _, section := range schemaOf(reflect.TypeFor[T]()).Sections {
+		// Compare what is stored rather than the values, since decoding
+		// turns nil maps and slices into empty ones.
+		if reflect.DeepEqual(encodeStruct(section.value(v), section.Fields), encodeStruct(section.value(root), section.Fields)) {
+			continue
+		}
+		changed = append(changed, section)
+		validateStruct(section.value(root), section.Fields, section.Name+".", &errs, nil)
+	}
+	if len(changed) == 0 {
+		// Only fields hidden by overlays may have changed.
+		p.stored = stored
+		return nil, nil
+	}
+	if len(errs.Errors) == 0 {
+		for _, section := range changed {
+			callValidators(section.value(root), section.Fields, section.Name+".", root.Addr().Interface(), &errs)
+		}
+		if cv, ok := root.Addr().Interface().(ConfigValidator); ok {
+			addValidatorError(&errs, "", cv.ValidateConfig())
+		}
+	}
+	if len(errs.Errors) > 0 {
+		return nil, &errs
+	}
+
+	previous := reflect.New(v.Type()).Elem()
+	previous.Set(v)
+	previousStored := p.stored
+	v.Set(root)
+	p.stored = stored
+	names := make([]string, len(changed))
+	for i, section := range changed {
+		names[i] = section.Name
+		if ur, ok := section.value(v).Addr().Interface().(UpdateReceiver); ok {
+			if err := ur.Updated(p.config, p); err != nil {
+				v.Set(previous)
+				p.stored = previousStored
+				// Let the hooks that accepted the reload undo what they
+				// did for it, like updateSection does on a failed save.
+				for _, accepted := range changed[:i] {
+					if ur, ok := accepted.value(v).Addr().Interface().(UpdateReceiver); ok {
+						ur.Updated(p.config, p)
+					}
+				}
+				return nil, fmt.Errorf("%s: %w", section.Name, err)
+			}
+		}
+	}
+	for _, section := range changed {
+		p.record(Change{Source: "reload"}, section, section.value(previous))
+	}
+	return names, nil
+}
@@ -0,0 +1,227 @@
+package web_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gwangyi/webcfg/web"
+)
+
+type WatchedSection struct {
+	Port    int `web:"port" validate:"max=65535"`
+	updates int
+}
+
+func (s *WatchedSection) Updated(parent any, n web.Notifier) error {
+	s.updates++
+	if s.Port == 13 {
+		return errors.New("unlucky port")
+	}
+	return nil
+}
+
+type WatchedConfig struct {
+	Server WatchedSection
+	Admin  WatchedSection
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"Server": {"port": 80}, "Admin": {"port": 81}}`), 0o644)
+
+	cfg := &WatchedConfig{}
+	var changes []web.Change
+	handler, err := web.New(cfg,
+		web.WithStore[WatchedConfig](web.NewJSONFileStore[WatchedConfig](path)),
+		web.WithWatch(time.Millisecond),
+		web.WithAudit(func(c web.Change) { changes = append(changes, c) }),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer handler.Close()
+	c := &client{}
+
+	os.WriteFile(path, []byte(`{"Server": {"port": 8080}, "Admin": {"port": 81}}`), 0o644)
+	waitFor(t, func() bool { return handler.Snapshot().Server.Port == 8080 })
+	handler.Read(func(cfg *WatchedConfig) {
+		if cfg.Server.updates != 1 || cfg.Admin.updates != 0 {
+			t.Errorf("expected only the changed section to be updated, got %d and %d", cfg.Server.updates, cfg.Admin.updates)
+		}
+		// The audit function runs under the write lock.
+		if len(changes) != 1 || changes[0].Section != "Server" || changes[0].Source != "reload" || changes[0].Fields[0].New != "8080" {
+			t.Errorf("unexpected changes %+v", changes)
+		}
+	})
+	if body := c.get(handler); !strings.Contains(body, "Reloaded Server from") {
+		t.Errorf("expected reload notification")
+	}
+
+	t.Run("Invalid value", func(t *testing.T) {
+		os.WriteFile(path, []byte(`{"Server": {"port": 70000}, "Admin": {"port": 81}}`), 0o644)
+		waitFor(t, func() bool { return strings.Contains(c.get(handler), "failed") })
+		if port := handler.Snapshot().Server.Port; port != 8080 {
+			t.Errorf("expected rejected reload to keep 8080, got %d", port)
+		}
+	})
+
+	t.Run("Hook error", func(t *testing.T) {
+		os.WriteFile(path, []byte(`{"Server": {"port": 13}, "Admin": {"port": 82}}`), 0o644)
+		waitFor(t, func() bool { return strings.Contains(c.get(handler), "unlucky port") })
+		if snapshot := handler.Snapshot(); snapshot.Server.Port != 8080 || snapshot.Admin.Port != 81 {
+			t.Errorf("expected rollback, got %+v", snapshot)
+		}
+	})
+
+	t.Run("Own saves", func(t *testing.T) {
+		handler.Update(func(cfg *WatchedConfig) error {
+			cfg.Admin.Port = 9090
+			return nil
+		})
+		time.Sleep(20 * time.Millisecond)
+		if body := c.get(handler); strings.Contains(body, "Reloaded") {
+			t.Errorf("expected no reload notification for own save")
+		}
+	})
+}
+
+type LabeledSection struct {
+	Labels  map[string]string `web:"labels"`
+	updates int
+}
+
+func (s *LabeledSection) Updated(parent any, n web.Notifier) error {
+	s.updates++
+	return nil
+}
+
+type LabeledConfig struct {
+	Server LabeledSection
+	Other  WatchedSection
+}
+
+func TestWatchUnchangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	cfg := &LabeledConfig{}
+	handler, err := web.New(cfg,
+		web.WithStore[LabeledConfig](web.NewJSONFileStore[LabeledConfig](path)),
+		web.WithWatch(time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer handler.Close()
+	c := &client{}
+	c.get(handler)
+
+	// The nil map is saved as {} and read back as an empty map.
+	handler.Update(func(cfg *LabeledConfig) error {
+		cfg.Other.Port = 80
+		return nil
+	})
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(path, later, later)
+	time.Sleep(20 * time.Millisecond)
+
+	handler.Read(func(cfg *LabeledConfig) {
+		if cfg.Server.updates != 0 || cfg.Other.updates != 0 {
+			t.Errorf("expected no hook to be called, got %d and %d", cfg.Server.updates, cfg.Other.updates)
+		}
+	})
+	if body := c.get(handler); strings.Contains(body, "Reloaded") {
+		t.Errorf("expected no reload notification")
+	}
+}
+
+func TestWatchRequiresPath(t *testing.T) {
+	if _, err := web.New(&StoredConfig{}, web.WithWatch(time.Second)); err == nil {
+		t.Errorf("expected error without store")
+	}
+	if _, err := web.New(&StoredConfig{}, web.WithStore[StoredConfig](&failingStore{}), web.WithWatch(time.Second)); err == nil {
+		t.Errorf("expected error for store without path")
+	}
+}
+
+func TestWatchKeepsOverlaysOutOfFile(t *testing.T) {
+	t.Setenv("APP_DATABASE_HOST", "envhost")
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"Database": {"MaxConns": 1}}`), 0o644)
+	store := web.NewJSONFileStore[EnvConfig](path)
+
+	cfg := &EnvConfig{Database: EnvSection{Host: "localhost"}}
+	handler, err := web.New(cfg, web.WithStore[EnvConfig](store), web.WithEnv("APP"), web.WithWatch(time.Millisecond))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer handler.Close()
+
+	os.WriteFile(path, []byte(`{"Database": {"MaxConns": 2}}`), 0o644)
+	waitFor(t, func() bool { return handler.Snapshot().Database.MaxConns == 2 })
+	if host := handler.Snapshot().Database.Host; host != "envhost" {
+		t.Errorf("expected the override to stay applied, got %q", host)
+	}
+	if err := handler.Update(func(cfg *EnvConfig) error {
+		cfg.Database.MaxConns = 3
+		return nil
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var saved EnvConfig
+	if err := store.Load(&saved); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if saved.Database.Host != "localhost" || saved.Database.MaxConns != 3 {
+		t.Errorf("expected the override not to be saved, got %+v", saved.Database)
+	}
+}
+
+type TwoHookedConfig struct {
+	First  HookedSection
+	Second HookedSection
+}
+
+func TestWatchHookErrorRollsBackAcceptedSections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"First": {"value": 1}, "Second": {"value": 2}}`), 0o644)
+
+	var first, second []int
+	cfg := &TwoHookedConfig{First: HookedSection{calls: &first}, Second: HookedSection{calls: &second}}
+	handler, err := web.New(cfg,
+		web.WithStore[TwoHookedConfig](web.NewJSONFileStore[TwoHookedConfig](path)),
+		web.WithWatch(time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer handler.Close()
+
+	os.WriteFile(path, []byte(`{"First": {"value": 5}, "Second": {"value": -1}}`), 0o644)
+	c := &client{}
+	waitFor(t, func() bool { return strings.Contains(c.get(handler), "negative value") })
+	handler.Read(func(cfg *TwoHookedConfig) {
+		if cfg.First.Value != 1 || cfg.Second.Value != 2 {
+			t.Errorf("expected rollback, got %d and %d", cfg.First.Value, cfg.Second.Value)
+		}
+		// The first hook accepted 5, and is told that 1 is live again.
+		if !slices.Equal(first, []int{5, 1}) || !slices.Equal(second, []int{-1}) {
+			t.Errorf("unexpected hook calls %v and %v", first, second)
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package web
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLFileStore stores the config as a YAML file keyed by section and tag
+// names. Saving merges the config into the existing file, so comments, key
+// order and keys unknown to the config are preserved. A missing file leaves
+// the config as it is.
+type YAMLFileStore[T any] struct {
+	path string
+}
+
+func NewYAMLFileStore[T any](path string) *YAMLFileStore[T] {
+	return &YAMLFileStore[T]{path: path}
+}
+
+// Path returns the file the store reads and writes.
+func (s *YAMLFileStore[T]) Path() string {
+	return s.path
+}
+
+func (s *YAMLFileStore[T]) Load(config *T) error {
+	data, err := readFile(s.path)
+	if err != nil || data == nil {
+		return err
+	}
+
+	var root any
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+	if root == nil {
+		return nil
+	}
+
+	d := &treeDecoder{}
+	d.decodeConfig(reflect.ValueOf(config).Elem(), root)
+	return d.err()
+}
+
+func (s *YAMLFileStore[T]) Save(config T) error {
+	data, err := readFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{}}}
+	}
+	mergeYAML(doc.Content[0], encodeConfig(reflect.ValueOf(&config).Elem()))
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, buf.Bytes())
+}
+
+// resetYAML turns node into an empty node of the given kind, keeping its
+// comments.
+func resetYAML(node *yaml.Node, kind yaml.Kind) {
+	if node.Kind == kind {
+		return
+	}
+	*node = yaml.Node{
+		Kind:        kind,
+		HeadComment: node.HeadComment,
+		LineComment: node.LineComment,
+		FootComment: node.FootComment,
+	}
+}
+
+// mergeYAML updates node in place to hold value, a tree produced by
+// encodeConfig, reusing existing nodes so that their comments survive.
+func mergeYAML(node *yaml.Node, value any) {
+	switch v := value.(type) {
+	case object:
+		mergeYAMLMapping(node, v, false)
+	case mapping:
+		mergeYAMLMapping(node, object(v), true)
+	case []any:
+		resetYAML(node, yaml.SequenceNode)
+		for i, item := range v {
+			if i == len(node.Content) {
+				node.Content = append(node.Content, &yaml.Node{})
+			}
+			mergeYAML(node.Content[i], item)
+		}
+		node.Content = node.Content[:len(v)]
+	default:
+		resetYAML(node, yaml.ScalarNode)
+		node.Tag, node.Value = yamlScalar(v)
+		if node.Tag != "!!str" {
+			node.Style = 0
+		}
+	}
+}
+
+// mergeYAMLMapping merges obj into the mapping node. Keys missing from obj
+// are kept unless it was encoded from a map.
+func mergeYAMLMapping(node *yaml.Node, obj object, removeMissing bool) {
+	resetYAML(node, yaml.MappingNode)
+	keys := map[string]bool{}
+	for _, m := range obj {
+		keys[m.Key] = true
+		found := false
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == m.Key {
+				mergeYAML(node.Content[i+1], m.Value)
+				found = true
+				break
+			}
+		}
+		if !found {
+			child := &yaml.Node{}
+			mergeYAML(child, m.Value)
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: m.Key}, child)
+		}
+	}
+
+	if removeMissing {
+		content := node.Content[:0]
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if keys[node.Content[i].Value] {
+				content = append(content, node.Content[i], node.Content[i+1])
+			}
+		}
+		node.Content = content
+	}
+}
+
+func yamlScalar(value any) (tag, text string) {
+	switch v := value.(type) {
+	case bool:
+		return "!!bool", strconv.FormatBool(v)
+	case int64:
+		return "!!int", strconv.FormatInt(v, 10)
+	case uint64:
+		return "!!int", strconv.FormatUint(v, 10)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "!!float", ".nan"
+		case math.IsInf(v, 1):
+			return "!!float", ".inf"
+		case math.IsInf(v, -1):
+			return "!!float", "-.inf"
+		}
+		return "!!float", formatFloat(v)
+	case string:
+		return "!!str", v
+	}
+	return "!!null", "null"
+}
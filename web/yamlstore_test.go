@@ -0,0 +1,107 @@
+package web_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gwangyi/webcfg/web"
+)
+
+func TestYAMLFileStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	store := web.NewYAMLFileStore[StoredConfig](path)
+
+	var cfg StoredConfig
+	cfg.Server = StoredSection{
+		Name:    "123",
+		Port:    8080,
+		Ratio:   2,
+		Enabled: true,
+		Custom:  MyTextUnmarshaler{Value: "custom"},
+		Regions: []string{"eu", "us"},
+		Labels:  map[string]string{"b": "2", "a": "true"},
+		Pool:    PoolConfig{MaxConns: 10, MinConns: 1},
+	}
+	cfg.Server.Backends = append(cfg.Server.Backends, struct {
+		Host string `web:"host"`
+	}{Host: "backend"})
+	cfg.Other.Value = 7
+
+	if err := store.Save(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var loaded StoredConfig
+	if err := store.Load(&loaded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, _ := json.Marshal(loaded)
+	want, _ := json.Marshal(cfg)
+	if string(got) != string(want) {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestYAMLFileStorePreservesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`# Managed by hand
+Other:
+  value: 1
+Server:
+  # Listen port
+  port: 80 # default
+  unknown: keep
+  labels:
+    stale: x
+`), 0o644)
+	store := web.NewYAMLFileStore[StoredConfig](path)
+
+	var cfg StoredConfig
+	if err := store.Load(&cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg.Server.Port = 9090
+	cfg.Server.Labels = map[string]string{"env": "prod"}
+	if err := store.Save(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	content := string(data)
+	for _, want := range []string{"# Managed by hand", "# Listen port", "port: 9090 # default", "unknown: keep", "env: prod"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in file, got:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, "stale") {
+		t.Errorf("expected removed map key to be dropped, got:\n%s", content)
+	}
+	if strings.Index(content, "Other:") > strings.Index(content, "Server:") {
+		t.Errorf("expected key order to be kept, got:\n%s", content)
+	}
+}
+
+func TestYAMLFileStoreCommentedOutSection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte("Server:\n  # name: x\nOther:\n  value: 1\n"), 0o644)
+	store := web.NewYAMLFileStore[StoredConfig](path)
+
+	cfg := StoredConfig{Server: StoredSection{Port: 80}}
+	if err := store.Load(&cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Server.Port != 80 || cfg.Other.Value != 1 {
+		t.Errorf("expected the empty section to keep its values, got %+v", cfg)
+	}
+	if err := store.Save(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var loaded StoredConfig
+	if err := store.Load(&loaded); err != nil || loaded.Server.Port != 80 {
+		data, _ := os.ReadFile(path)
+		t.Errorf("expected the section to be saved, got %v:\n%s", err, data)
+	}
+}